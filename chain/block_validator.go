@@ -0,0 +1,208 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
+)
+
+const (
+	// allowedFutureBlockTime is the max time from current time allowed for blocks,
+	// before they're considered future blocks.
+	allowedFutureBlockTime = 15 * time.Second
+
+	GasLimitBoundDivisor uint64 = 1024               // The bound divisor of the gas limit, used in update calculations.
+	MinGasLimit          uint64 = 5000               // Minimum the gas limit may ever be.
+	MaxGasLimit          uint64 = 0x7fffffffffffffff // Maximum the gas limit (2^63-1).
+)
+
+// BlockValidator is responsible for validating block headers, bodies and
+// processed state.
+//
+// BlockValidator implements Validator.
+type BlockValidator struct {
+	bc     *BlockChain      // Canonical block chain
+	engine consensus.Engine // Consensus engine used for validating
+}
+
+// NewBlockValidator returns a new block validator which is safe for re-use.
+// The engine may be nil, in which case block seals are not verified.
+func NewBlockValidator(blockchain *BlockChain, engine consensus.Engine) *BlockValidator {
+	validator := &BlockValidator{
+		engine: engine,
+		bc:     blockchain,
+	}
+	return validator
+}
+
+// ValidateHeader checks whether a header conforms to the consensus rules in
+// relation to its parent: number, timestamp, gas limit and usage and, from London
+// on, the base fee. The engine
+// specific fields and the seal are verified by the consensus engine, if any.
+func (v *BlockValidator) ValidateHeader(header, parent *types.Header) error {
+	// Verify that the block number is parent's +1
+	if header.Number != parent.Number+1 {
+		return fmt.Errorf("%w: have %d, want %d", ErrInvalidNumber, header.Number, parent.Number+1)
+	}
+	if err := verifyHeaderBounds(header); err != nil {
+		return err
+	}
+	if header.Time <= parent.Time {
+		return fmt.Errorf("%w: have %d, parent %d", ErrOlderBlockTime, header.Time, parent.Time)
+	}
+	// Verify the block's gas usage and (if applicable) verify the base fee.
+	config := v.bc.chainConfig
+	if !config.IsLondon(new(big.Int).SetUint64(header.Number)) {
+		// Verify BaseFee not present before EIP-1559 fork.
+		if header.BaseFee != nil {
+			return fmt.Errorf("%w: have %v, expected 'nil'", ErrInvalidBaseFee, header.BaseFee)
+		}
+		if err := verifyGasLimit(parent.GasLimit, header.GasLimit); err != nil {
+			return err
+		}
+	} else if err := verifyEip1559Header(config, parent, header); err != nil {
+		// Verify the header's EIP-1559 attributes.
+		return err
+	}
+	if v.engine != nil {
+		if err := v.engine.VerifyHeader(v.bc, header, true); err != nil {
+			return fmt.Errorf("consensus rules violated: %w", err)
+		}
+	}
+	return nil
+}
+
+// sealVerifier is implemented by consensus engines able to check a block seal
+// without access to the parent, like ethash.
+type sealVerifier interface {
+	VerifySeal(header *types.Header) error
+}
+
+// ValidateSanity checks the parts of a block that can be verified without its
+// parent: the header bounds, the body commitment and, if the engine supports
+// it, the seal. It is used to screen blocks before they are kept around while
+// their parent is unknown.
+func (v *BlockValidator) ValidateSanity(block *types.Block) error {
+	header := block.Header()
+	if header.Number == 0 {
+		return fmt.Errorf("%w: non-genesis block with number 0", ErrInvalidNumber)
+	}
+	if err := verifyHeaderBounds(header); err != nil {
+		return err
+	}
+	if err := v.ValidateBody(block); err != nil {
+		return err
+	}
+	if verifier, ok := v.engine.(sealVerifier); ok {
+		if err := verifier.VerifySeal(header); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSeal, err)
+		}
+	}
+	return nil
+}
+
+// ValidateBody validates the given block's transactions against the header
+// commitment.
+func (v *BlockValidator) ValidateBody(block *types.Block) error {
+	header := block.Header()
+	if hash := types.CalcTxHash(block.Transactions()); hash != header.TxHash {
+		return fmt.Errorf("%w: have %x, want %x", ErrTxHashMismatch, hash, header.TxHash)
+	}
+	return nil
+}
+
+// ValidateState validates the various changes that happen after a state
+// transition, such as amount of used gas, the receipt root and the state root
+// itself.
+func (v *BlockValidator) ValidateState(block *types.Block, statedb *state.StateDB, receipts []*types.Receipt, usedGas uint64) error {
+	header := block.Header()
+	if block.GasUsed() != usedGas {
+		return fmt.Errorf("%w (remote: %v local: %v)", ErrGasUsedMismatch, block.GasUsed(), usedGas)
+	}
+
+	// Validate the received block's bloom with the one derived from the generated receipts.
+	// For valid blocks this should always validate to true.
+	if rbloom := types.CreateBloom(receipts); rbloom != header.LogsBloom {
+		return fmt.Errorf("%w (remote: %x  local: %x)", ErrBloomMismatch, header.LogsBloom, rbloom)
+	}
+	// Validate the received block's receipt root against the locally computed one
+	if receiptSha := types.CalcReceiptHash(receipts); receiptSha != header.ReceiptHash {
+		return fmt.Errorf("%w (remote: %x local: %x)", ErrReceiptHashMismatch, header.ReceiptHash, receiptSha)
+	}
+	// Validate the state root against the received state root and throw
+	// an error if they don't match.
+	if root := statedb.IntermediateRoot(v.bc.chainConfig.IsEIP158(new(big.Int).SetUint64(header.Number))); header.Root != root {
+		return fmt.Errorf("%w (remote: %x local: %x)", ErrStateRootMismatch, header.Root, root)
+	}
+	return nil
+}
+
+// verifyHeaderBounds verifies the header fields that are bounded on their own:
+// the timestamp may not be too far in the future, the gas limit may not exceed
+// 2^63-1 and the gas used may not exceed the gas limit.
+func verifyHeaderBounds(header *types.Header) error {
+	if header.Time > uint64(time.Now().Add(allowedFutureBlockTime).Unix()) {
+		return fmt.Errorf("%w: timestamp %d", ErrFutureBlock, header.Time)
+	}
+	if header.GasLimit > MaxGasLimit {
+		return fmt.Errorf("%w: have %v, max %v", ErrInvalidGasLimit, header.GasLimit, MaxGasLimit)
+	}
+	if header.GasUsed > header.GasLimit {
+		return fmt.Errorf("%w: have %d, gasLimit %d", ErrInvalidGasUsed, header.GasUsed, header.GasLimit)
+	}
+	return nil
+}
+
+// verifyGasLimit verifies the header gas limit according increase/decrease
+// in relation to the parent gas limit.
+func verifyGasLimit(parentGasLimit, headerGasLimit uint64) error {
+	// Verify that the gas limit remains within allowed bounds
+	diff := int64(parentGasLimit) - int64(headerGasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	// The limit may change by less than 1/1024 of the parent's. Keeping it as is
+	// is always allowed, even below 1024 gas where no change is permitted.
+	limit := parentGasLimit / GasLimitBoundDivisor
+	if diff != 0 && uint64(diff) >= limit {
+		var maxDiff uint64
+		if limit > 0 {
+			maxDiff = limit - 1
+		}
+		return fmt.Errorf("%w: have %d, want %d += %d", ErrInvalidGasLimit, headerGasLimit, parentGasLimit, maxDiff)
+	}
+	if headerGasLimit < MinGasLimit {
+		return fmt.Errorf("%w: have %d, minimum %d", ErrInvalidGasLimit, headerGasLimit, MinGasLimit)
+	}
+	return nil
+}
+
+// CalcGasLimit computes the gas limit of the next block after parent. It aims
+// to keep the baseline gas close to the provided target, and increase it towards
+// the target if the baseline gas is lower.
+func CalcGasLimit(parentGasLimit, desiredLimit uint64) uint64 {
+	delta := parentGasLimit/GasLimitBoundDivisor - 1
+	limit := parentGasLimit
+	if desiredLimit < MinGasLimit {
+		desiredLimit = MinGasLimit
+	}
+	// If we're outside our allowed gas range, we try to hone towards them
+	if limit < desiredLimit {
+		limit = parentGasLimit + delta
+		if limit > desiredLimit {
+			limit = desiredLimit
+		}
+		return limit
+	}
+	if limit > desiredLimit {
+		limit = parentGasLimit - delta
+		if limit < desiredLimit {
+			limit = desiredLimit
+		}
+	}
+	return limit
+}
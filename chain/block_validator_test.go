@@ -0,0 +1,36 @@
+package chain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyGasLimit(t *testing.T) {
+	for i, tc := range []struct {
+		parent, limit uint64
+		ok            bool
+	}{
+		{8000000, 8000000, true},  // No change
+		{8000000, 8007811, true},  // Upper limit
+		{8000000, 8007812, false}, // Upper +1
+		{8000000, 7992189, true},  // Lower limit
+		{8000000, 7992188, false}, // Lower -1
+		{1023, 5000, false},       // No change allowed below 1024
+		{5000, 4999, false},       // Below the minimum
+	} {
+		err := verifyGasLimit(tc.parent, tc.limit)
+		if tc.ok && err != nil {
+			t.Errorf("test %d: have error %v, want none", i, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrInvalidGasLimit) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, ErrInvalidGasLimit)
+		}
+	}
+	// An unchanged limit below 1024 is only rejected for undercutting the
+	// minimum, not for exceeding a bound that permits no change at all
+	err := verifyGasLimit(1000, 1000)
+	if !errors.Is(err, ErrInvalidGasLimit) || !strings.Contains(err.Error(), "minimum") {
+		t.Errorf("unchanged low limit: have %v, want minimum gas limit error", err)
+	}
+}
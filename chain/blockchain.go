@@ -1,30 +1,181 @@
 package chain
 
 import (
+	"errors"
+	"math/big"
+	"sync"
 	"sync/atomic"
 
+	"github.com/universe-30/mt-bc/chain/rawdb"
+	"github.com/universe-30/mt-bc/chain/state"
 	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-bc/params"
 	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+var (
+	// errInvalidHead is returned when the stored head pointer references a
+	// block that can no longer be assembled from the database.
+	errInvalidHead = errors.New("head block missing from database")
+
+	errMissingTd       = errors.New("missing total difficulty")
+	errInvalidOldChain = errors.New("invalid old chain")
+	errInvalidNewChain = errors.New("invalid new chain")
 )
 
 type BlockChain struct {
-	db accdb.Database // Low level persistent database to store final content in
+	db          accdb.Database      // Low level persistent database to store final content in
+	stateCache  state.Database      // State database to reuse between imports (contains state cache)
+	chainConfig *params.ChainConfig // Chain & network configuration
+
+	chainmu sync.Mutex // blockchain insertion lock
 
 	currentBlock atomic.Value // Current head of the block chain
 
-	processor Processor // Block transaction processor interface
+	engine    consensus.Engine // Consensus engine used to verify block seals
+	validator Validator        // Block and state validator interface
+	processor Processor        // Block transaction processor interface
 
+	orphans *orphanPool // Blocks waiting for their parent to arrive
+
+	feedmu    sync.Mutex      // Protects the event subscriber lists
+	reorgFeed []*reorgSub     // Subscribers notified on canonical chain switches
+	headFeed  []*chainHeadSub // Subscribers notified on new canonical heads
 }
 
-func NewBlockChain() (*BlockChain, error) {
+// NewBlockChain returns a fully initialised block chain using the information
+// available in the database. If the database already holds a chain, the head
+// block is restored from it; otherwise the chain starts empty and the first
+// inserted block becomes its genesis. Transaction senders are recovered with
+// the replay protection and blocks are executed under the protocol rules that
+// chainConfig schedules, and the given consensus engine verifies the engine
+// specific header fields and seals and finalizes the block state.
+func NewBlockChain(db accdb.Database, chainConfig *params.ChainConfig, engine consensus.Engine) (*BlockChain, error) {
 
-	bc := &BlockChain{}
+	bc := &BlockChain{
+		db:          db,
+		stateCache:  state.NewDatabase(db),
+		chainConfig: chainConfig,
+		engine:      engine,
+		orphans:     newOrphanPool(),
+	}
 
+	bc.validator = NewBlockValidator(bc, engine)
 	bc.processor = NewStateProcessor(bc)
 
+	if err := bc.loadLastState(); err != nil {
+		return nil, err
+	}
 	return bc, nil
 }
 
+// loadLastState loads the last known chain state from the database.
+func (bc *BlockChain) loadLastState() error {
+	// Restore the last known head block
+	head := rawdb.ReadHeadBlockHash(bc.db)
+	if head == (common.Hash{}) {
+		// Fresh database, nothing to restore
+		return nil
+	}
+	currentBlock := bc.GetBlockByHash(head)
+	if currentBlock == nil {
+		return errInvalidHead
+	}
+	bc.currentBlock.Store(currentBlock)
+	return nil
+}
+
+// CurrentBlock retrieves the current head block of the canonical chain. It
+// returns nil if no block, not even the genesis, has been inserted yet.
 func (bc *BlockChain) CurrentBlock() *types.Block {
-	return bc.currentBlock.Load().(*types.Block)
+	block, _ := bc.currentBlock.Load().(*types.Block)
+	return block
+}
+
+// StateAt returns a new mutable state based on a particular point in time.
+func (bc *BlockChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	return state.New(root, bc.stateCache)
+}
+
+// Config retrieves the chain's fork configuration.
+func (bc *BlockChain) Config() *params.ChainConfig { return bc.chainConfig }
+
+// Engine retrieves the blockchain's consensus engine.
+func (bc *BlockChain) Engine() consensus.Engine { return bc.engine }
+
+// GetBlock retrieves a block from the database by hash and number.
+func (bc *BlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	return rawdb.ReadBlock(bc.db, hash, number)
+}
+
+// GetBlockByHash retrieves a block from the database by hash.
+func (bc *BlockChain) GetBlockByHash(hash common.Hash) *types.Block {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return bc.GetBlock(hash, *number)
+}
+
+// GetBlockByNumber retrieves a canonical block from the database by number.
+func (bc *BlockChain) GetBlockByNumber(number uint64) *types.Block {
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return bc.GetBlock(hash, number)
+}
+
+// CurrentHeader retrieves the current head header of the canonical chain.
+func (bc *BlockChain) CurrentHeader() *types.Header {
+	if block := bc.CurrentBlock(); block != nil {
+		return block.Header()
+	}
+	return nil
+}
+
+// GetHeader retrieves a block header from the database by hash and number.
+func (bc *BlockChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	return rawdb.ReadHeader(bc.db, hash, number)
+}
+
+// GetHeaderByHash retrieves a block header from the database by hash.
+func (bc *BlockChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return bc.GetHeader(hash, *number)
+}
+
+// GetHeaderByNumber retrieves a canonical block header from the database by
+// number.
+func (bc *BlockChain) GetHeaderByNumber(number uint64) *types.Header {
+	hash := rawdb.ReadCanonicalHash(bc.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return bc.GetHeader(hash, number)
+}
+
+// GetTd retrieves a block's total difficulty from the database by hash and
+// number.
+func (bc *BlockChain) GetTd(hash common.Hash, number uint64) *big.Int {
+	return rawdb.ReadTd(bc.db, hash, number)
+}
+
+// GetReceiptsByHash retrieves the receipts for all transactions in a given block.
+func (bc *BlockChain) GetReceiptsByHash(hash common.Hash) []*types.Receipt {
+	number := rawdb.ReadHeaderNumber(bc.db, hash)
+	if number == nil {
+		return nil
+	}
+	return rawdb.ReadReceipts(bc.db, hash, *number)
+}
+
+// HasBlock checks if a block is fully present in the database or not.
+func (bc *BlockChain) HasBlock(hash common.Hash, number uint64) bool {
+	return rawdb.HasBody(bc.db, hash, number)
 }
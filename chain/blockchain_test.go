@@ -1,12 +1,38 @@
 package chain
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"testing"
+	"time"
 
+	"github.com/universe-30/mt-bc/chain/state"
 	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
 	"github.com/universe-30/mt-bc/consensus/ethash.go"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+)
+
+var (
+	// testChainConfig schedules every fork but London, so that the test blocks
+	// need no base fee and their free transactions remain executable.
+	testChainConfig = &params.ChainConfig{
+		ChainID:        big.NewInt(1337),
+		HomesteadBlock: big.NewInt(0),
+		EIP155Block:    big.NewInt(0),
+		EIP158Block:    big.NewInt(0),
+		IstanbulBlock:  big.NewInt(0),
+		BerlinBlock:    big.NewInt(0),
+	}
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = crypto.PubkeyToAddress(testKey.PublicKey)
+	testSigner = types.LatestSigner(testChainConfig)
 )
 
 func TestSetBlockData(t *testing.T) {
@@ -15,12 +41,17 @@ func TestSetBlockData(t *testing.T) {
 
 	bc := CreateNewBlockChain(genesisBlock)
 
-	currentBlock := CreateNewBlock(genesisBlock)
+	currentBlock := createBlockWithData(bc, genesisBlock, "aabc")
 
-	bc.InsertBlock(currentBlock)
+	if err := bc.InsertBlock(currentBlock); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	if head := bc.CurrentBlock().Hash(); head != currentBlock.Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, currentBlock.Hash())
+	}
 
 	log.Printf("bc out:")
-	log.Printf("detail: %v", *bc)
+	log.Printf("detail: %v", bc)
 
 	fmt.Printf("detail: %+v", bc)
 }
@@ -29,15 +60,20 @@ func TestBlockDataEqual(t *testing.T) {
 
 	genesisBlock := CreateGenesisBlock()
 
+	// The faker seals with a zero nonce, so equal blocks get equal hashes
 	bc := CreateNewBlockChain(genesisBlock)
-	currentBlock := CreateNewBlock(genesisBlock)
-	bc.InsertBlock(currentBlock)
+	currentBlock := sealBlockWith(ethash.NewFaker(), assembleBlockWithData(bc, genesisBlock, "aabc"))
+	if err := bc.InsertBlock(currentBlock); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
 
 	genesisBlock2 := CreateGenesisBlock()
 
 	bc2 := CreateNewBlockChain(genesisBlock2)
-	currentBlock2 := CreateNewBlock(genesisBlock2)
-	bc2.InsertBlock(currentBlock2)
+	currentBlock2 := sealBlockWith(ethash.NewFaker(), assembleBlockWithData(bc2, genesisBlock2, "aabc"))
+	if err := bc2.InsertBlock(currentBlock2); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
 
 	if currentBlock.Hash() != currentBlock2.Hash() {
 		t.Errorf("Hash Not Equal %x, %x", currentBlock.Hash(), currentBlock2.Hash())
@@ -46,31 +82,417 @@ func TestBlockDataEqual(t *testing.T) {
 	}
 
 	log.Printf("bc out:")
-	log.Printf("detail: %v", *bc)
+	log.Printf("detail: %v", bc)
 	log.Printf("detail2: %v", bc2)
 }
 
+func TestBlockChainRestart(t *testing.T) {
+
+	db := memorydb.New()
+
+	genesisBlock := CreateGenesisBlock()
+	bc := createBlockChainWithDB(db, genesisBlock)
+
+	block := createBlockWithData(bc, genesisBlock, "block")
+	if err := bc.InsertBlock(block); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+
+	// Reopen the chain on the same database and ensure the head survived
+	restarted, err := NewBlockChain(db, testChainConfig, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	if head := restarted.CurrentBlock(); head == nil || head.Hash() != block.Hash() {
+		t.Fatalf("head mismatch after restart: have %v, want %x", head, block.Hash())
+	}
+	if hash := restarted.GetBlockByNumber(genesisBlock.NumberU64()).Hash(); hash != genesisBlock.Hash() {
+		t.Errorf("genesis mismatch after restart: have %x, want %x", hash, genesisBlock.Hash())
+	}
+}
+
+// failingDB is a database whose batches fail to write once fail is set.
+type failingDB struct {
+	accdb.Database
+	fail bool
+}
+
+type failingBatch struct {
+	accdb.Batch
+	db *failingDB
+}
+
+func (db *failingDB) NewBatch() accdb.Batch {
+	return &failingBatch{Batch: db.Database.NewBatch(), db: db}
+}
+
+func (b *failingBatch) Write() error {
+	if b.db.fail {
+		return errors.New("write failed")
+	}
+	return b.Batch.Write()
+}
+
+func TestFailedWriteKeepsHead(t *testing.T) {
+
+	db := &failingDB{Database: memorydb.New()}
+
+	genesisBlock := CreateGenesisBlock()
+	bc := createBlockChainWithDB(db, genesisBlock)
+
+	block := createBlockWithData(bc, genesisBlock, "block")
+	db.fail = true
+	if err := bc.InsertBlock(block); err == nil {
+		t.Fatal("block inserted despite failing writes")
+	}
+	if head := bc.CurrentBlock(); head.Hash() != genesisBlock.Hash() {
+		t.Fatalf("head moved after failed write: have %x, want %x", head.Hash(), genesisBlock.Hash())
+	}
+	if bc.HasBlock(block.Hash(), block.NumberU64()) {
+		t.Fatal("block persisted despite failing writes")
+	}
+
+	// Once writes succeed again the block is accepted and survives a restart
+	db.fail = false
+	if err := bc.InsertBlock(block); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	restarted, err := NewBlockChain(db, testChainConfig, nil)
+	if err != nil {
+		t.Fatalf("failed to reopen chain: %v", err)
+	}
+	if head := restarted.CurrentBlock(); head == nil || head.Hash() != block.Hash() {
+		t.Fatalf("head mismatch after restart: have %v, want %x", head, block.Hash())
+	}
+}
+
 // 生成区块链
 func CreateNewBlockChain(genesisBlock *types.Block) *BlockChain {
-	blockChain, _ := NewBlockChain()
+	return createBlockChainWithDB(memorydb.New(), genesisBlock)
+}
+
+func createBlockChainWithDB(db accdb.Database, genesisBlock *types.Block) *BlockChain {
+	blockChain, _ := NewBlockChain(db, testChainConfig, nil)
 	blockChain.InsertBlock(genesisBlock)
 	return blockChain
 }
 
-func CreateNewBlock(prevBlock *types.Block) *types.Block {
-	data := types.NewTxWithString("aabc")
-	txs := []*types.Transaction{data}
+// sealBlock runs the proof-of-work search for the block and returns the sealed
+// result.
+func sealBlock(block *types.Block) *types.Block {
+	return sealBlockWith(ethash.NewTester(), block)
+}
+
+// sealBlockWith seals the block with the given engine and returns the result.
+func sealBlockWith(engine consensus.Engine, block *types.Block) *types.Block {
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(nil, block, results, nil); err != nil {
+		log.Panic(err)
+	}
+	return <-results
+}
+
+func TestReorgToHeavierFork(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc := CreateNewBlockChain(genesisBlock)
+
+	events := make(chan ReorgEvent, 1)
+	defer bc.SubscribeReorgEvent(events)()
+
+	// Canonical chain: genesis -> a1 -> a2
+	a1 := createBlockWithData(bc, genesisBlock, "a1")
+	a2 := createBlockWithData(bc, a1, "a2")
+	// Competing fork: genesis -> b1 -> b2 -> b3
+	b1 := createBlockWithData(bc, genesisBlock, "b1")
+	b2 := createBlockWithData(bc, b1, "b2")
+	b3 := createBlockWithData(bc, b2, "b3")
+
+	for _, block := range []*types.Block{a1, a2, b1, b2} {
+		if err := bc.InsertBlock(block); err != nil {
+			t.Fatalf("failed to insert block %d: %v", block.NumberU64(), err)
+		}
+	}
+	if head := bc.CurrentBlock().Hash(); head != a2.Hash() {
+		t.Fatalf("equal weight fork replaced head: have %x, want %x", head, a2.Hash())
+	}
+
+	if err := bc.InsertBlock(b3); err != nil {
+		t.Fatalf("failed to insert block %d: %v", b3.NumberU64(), err)
+	}
+	if head := bc.CurrentBlock().Hash(); head != b3.Hash() {
+		t.Fatalf("heavier fork not adopted: have %x, want %x", head, b3.Hash())
+	}
+	for _, block := range []*types.Block{b1, b2, b3} {
+		if hash := bc.GetBlockByNumber(block.NumberU64()).Hash(); hash != block.Hash() {
+			t.Errorf("canonical hash mismatch at %d: have %x, want %x", block.NumberU64(), hash, block.Hash())
+		}
+	}
+
+	select {
+	case ev := <-events:
+		if len(ev.OldChain) != 2 || len(ev.NewChain) != 3 {
+			t.Errorf("reorg size mismatch: dropped %d, added %d", len(ev.OldChain), len(ev.NewChain))
+		}
+	default:
+		t.Errorf("no reorg event posted")
+	}
+}
+
+func TestReorgEventsAndTotalDifficulty(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc := CreateNewBlockChain(genesisBlock)
+
+	reorgs := make(chan ReorgEvent, 1)
+	defer bc.SubscribeReorgEvent(reorgs)()
+	heads := make(chan ChainHeadEvent, 4)
+	defer bc.SubscribeChainHeadEvent(heads)()
+
+	a1 := createBlockWithData(bc, genesisBlock, "a1")
+	a2 := createBlockWithData(bc, a1, "a2")
+	b1 := createBlockWithData(bc, genesisBlock, "b1")
+	b2 := createBlockWithData(bc, b1, "b2")
+	b3 := createBlockWithData(bc, b2, "b3")
+
+	for _, block := range []*types.Block{a1, a2, b1, b2, b3} {
+		if err := bc.InsertBlock(block); err != nil {
+			t.Fatalf("failed to insert block %d: %v", block.NumberU64(), err)
+		}
+	}
+	// The total difficulty accumulates along each branch separately
+	td := new(big.Int).Set(bc.GetTd(genesisBlock.Hash(), genesisBlock.NumberU64()))
+	for _, block := range []*types.Block{b1, b2, b3} {
+		td.Add(td, block.Difficulty())
+		if have := bc.GetTd(block.Hash(), block.NumberU64()); have == nil || have.Cmp(td) != 0 {
+			t.Fatalf("td mismatch at %d: have %v, want %v", block.NumberU64(), have, td)
+		}
+	}
+	if side := bc.GetTd(a2.Hash(), a2.NumberU64()); side.Cmp(td) >= 0 {
+		t.Fatalf("side chain td %v not below canonical td %v", side, td)
+	}
+	// The reorg lists both branches from the top down to the common ancestor
+	ev := <-reorgs
+	want := [][]*types.Block{{a2, a1}, {b3, b2, b1}}
+	for i, have := range [][]*types.Block{ev.OldChain, ev.NewChain} {
+		if len(have) != len(want[i]) {
+			t.Fatalf("reorg list %d length mismatch: have %d, want %d", i, len(have), len(want[i]))
+		}
+		for j := range have {
+			if have[j].Hash() != want[i][j].Hash() {
+				t.Errorf("reorg list %d item %d mismatch: have %x, want %x", i, j, have[j].Hash(), want[i][j].Hash())
+			}
+		}
+	}
+	// Only the blocks extending or replacing the head announced a new head
+	for _, block := range []*types.Block{a1, a2, b3} {
+		if ev := <-heads; ev.Block.Hash() != block.Hash() {
+			t.Errorf("head event mismatch: have %x, want %x", ev.Block.Hash(), block.Hash())
+		}
+	}
+	if len(heads) != 0 {
+		t.Errorf("unexpected head events: %d", len(heads))
+	}
+}
+
+func TestUnsubscribeReleasesDelivery(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc := CreateNewBlockChain(genesisBlock)
+
+	// Nobody reads the unbuffered channel, so the delivery blocks
+	unsubscribe := bc.SubscribeChainHeadEvent(make(chan ChainHeadEvent))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bc.InsertBlock(createBlockWithData(bc, genesisBlock, "block"))
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("insertion returned before the event was consumed: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	unsubscribe()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to insert block: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unsubscribing did not release the blocked delivery")
+	}
+	unsubscribe() // Cancelling twice is harmless
+}
+
+func TestOrphanBlocksConnected(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc := CreateNewBlockChain(genesisBlock)
+
+	b1 := createBlockWithData(bc, genesisBlock, "b1")
+	b2 := createBlockWithData(bc, b1, "b2")
+	b3 := createBlockWithData(bc, b2, "b3")
+
+	// Deliver the descendants before their parent
+	for _, block := range []*types.Block{b3, b2} {
+		if err := bc.InsertBlock(block); !errors.Is(err, ErrBlockQueued) {
+			t.Fatalf("orphan %d not queued: %v", block.NumberU64(), err)
+		}
+	}
+	if n := bc.orphans.len(); n != 2 {
+		t.Fatalf("orphan count mismatch: have %d, want 2", n)
+	}
+	if head := bc.CurrentBlock().Hash(); head != genesisBlock.Hash() {
+		t.Fatalf("orphan became head")
+	}
+
+	if err := bc.InsertBlock(b1); err != nil {
+		t.Fatalf("failed to insert parent: %v", err)
+	}
+	if bc.orphans.has(b2.Hash()) || bc.orphans.has(b3.Hash()) {
+		t.Errorf("orphans not connected")
+	}
+	if head := bc.CurrentBlock().Hash(); head != b3.Hash() {
+		t.Errorf("head mismatch: have %x, want %x", head, b3.Hash())
+	}
+}
+
+func TestInvalidOrphansRejected(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc, err := NewBlockChain(memorydb.New(), testChainConfig, ethash.NewTester())
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	bc.InsertBlock(genesisBlock)
+
+	b1 := createBlockWithData(bc, genesisBlock, "b1")
+	b2 := createBlockWithData(bc, b1, "b2")
+
+	tests := []struct {
+		name   string
+		modify func(header *types.Header)
+		err    error
+	}{
+		{"tx hash", func(h *types.Header) { h.TxHash = common.Hash{} }, ErrTxHashMismatch},
+		{"gas used", func(h *types.Header) { h.GasUsed = h.GasLimit + 1 }, ErrInvalidGasUsed},
+		{"seal", func(h *types.Header) { h.Nonce++ }, ErrInvalidSeal},
+	}
+	for _, tt := range tests {
+		header := types.CopyHeader(b2.Header())
+		tt.modify(header)
+		orphan := b2.WithSeal(header)
+
+		if err := bc.InsertBlock(orphan); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+		if bc.orphans.has(orphan.Hash()) {
+			t.Errorf("%s: invalid orphan queued", tt.name)
+		}
+	}
+	if err := bc.InsertBlock(b2); !errors.Is(err, ErrBlockQueued) {
+		t.Fatalf("valid orphan not queued: %v", err)
+	}
+}
+
+func TestInvalidSealRejected(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc, err := NewBlockChain(memorydb.New(), testChainConfig, ethash.NewTester())
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	bc.InsertBlock(genesisBlock)
+
+	// A block of the wrong difficulty is rejected, but not blamed on its seal
+	block := createBlockWithData(bc, genesisBlock, "block")
+	if err := bc.InsertBlock(block); err == nil || errors.Is(err, ErrInvalidSeal) {
+		t.Fatalf("wrong difficulty error mismatch: have %v", err)
+	}
+
+	// Give the block the difficulty ethash demands and seal it for real
+	header := types.CopyHeader(block.Header())
+	header.Difficulty = ethash.CalcDifficulty(header.Time, genesisBlock.Header())
+	block = sealBlock(block.WithSeal(header))
+
+	// Any other nonce no longer satisfies the proof-of-work
+	tampered := types.CopyHeader(block.Header())
+	tampered.Nonce++
+	if err := bc.InsertBlock(block.WithSeal(tampered)); !errors.Is(err, ErrInvalidSeal) {
+		t.Fatalf("tampered nonce error mismatch: have %v, want %v", err, ErrInvalidSeal)
+	}
+	if head := bc.CurrentBlock().Hash(); head != genesisBlock.Hash() {
+		t.Fatalf("tampered block became head")
+	}
+	if err := bc.InsertBlock(block); err != nil {
+		t.Fatalf("failed to insert sealed block: %v", err)
+	}
+	if head := bc.CurrentBlock().Hash(); head != block.Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, block.Hash())
+	}
+}
+
+func TestInvalidBlocksRejected(t *testing.T) {
+
+	genesisBlock := CreateGenesisBlock()
+	bc := CreateNewBlockChain(genesisBlock)
+
+	tests := []struct {
+		name   string
+		modify func(header *types.Header)
+		err    error
+	}{
+		{"old timestamp", func(h *types.Header) { h.Time = genesisBlock.Time() }, ErrOlderBlockTime},
+		{"future timestamp", func(h *types.Header) { h.Time = uint64(time.Now().Add(time.Hour).Unix()) }, ErrFutureBlock},
+		{"gas limit jump", func(h *types.Header) { h.GasLimit *= 2 }, ErrInvalidGasLimit},
+		{"tx hash", func(h *types.Header) { h.TxHash = common.Hash{} }, ErrTxHashMismatch},
+	}
+	for _, tt := range tests {
+		block := types.CreateNewBlock(genesisBlock, []*types.Transaction{types.NewTxWithString(tt.name)})
+		tt.modify(block.Header())
+
+		if err := bc.InsertBlock(block); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
 
-	block := types.CreateNewBlock(prevBlock, txs)
+// createBlockWithData assembles a block on top of prevBlock carrying the given
+// data in a transaction signed by the test account and seals it for real.
+func createBlockWithData(bc *BlockChain, prevBlock *types.Block, data string) *types.Block {
+	return sealBlock(assembleBlockWithData(bc, prevBlock, data))
+}
 
-	pow := ethash.NewProofOfWork()
-	hash, nonce, err := pow.Seal(block)
+// assembleBlockWithData assembles an unsealed block on top of prevBlock
+// carrying the given data in a transaction signed by the test account. The
+// block is executed against the parent state to fill in its post-state fields,
+// and that state is committed to the chain's state database so descendants can
+// be built before the block is inserted.
+func assembleBlockWithData(bc *BlockChain, prevBlock *types.Block, data string) *types.Block {
+	statedb, err := state.New(prevBlock.Root(), bc.stateCache)
 	if err != nil {
 		log.Panic(err)
-		return nil
 	}
+	tx := types.MustSignNewTx(testKey, testSigner, &types.LegacyTx{
+		Nonce: statedb.GetNonce(testAddr),
+		Gas:   100000,
+		To:    &common.Address{},
+		Data:  []byte(data),
+	})
+	block := types.CreateNewBlock(prevBlock, []*types.Transaction{tx})
 
-	block.SetFinal(hash, nonce)
+	receipts, usedGas, err := bc.processor.Process(block, statedb)
+	if err != nil {
+		log.Panic(err)
+	}
+	header := block.Header()
+	header.GasUsed = usedGas
+	header.ReceiptHash = types.CalcReceiptHash(receipts)
+	header.LogsBloom = types.CreateBloom(receipts)
+	if header.Root, err = statedb.Commit(true); err != nil {
+		log.Panic(err)
+	}
 
 	return block
 }
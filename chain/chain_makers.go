@@ -2,121 +2,336 @@ package chain
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"math/big"
 
-	"github.com/ethereum/go-ethereum/core/rawdb"
-	"github.com/ethereum/go-ethereum/core/state"
-	"github.com/ethereum/go-ethereum/log"
+	"github.com/universe-30/mt-bc/chain/rawdb"
+	"github.com/universe-30/mt-bc/chain/state"
 	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/common"
 )
 
 func (bc *BlockChain) insertChain(chain []*types.Block) error {
 
 	for _, b := range chain {
-		if err := bc.InsertBlock(b); err != nil {
+		if err := bc.InsertBlock(b); err != nil && !errors.Is(err, ErrBlockQueued) {
 			return err
 		}
 	}
 	return nil
 }
 
+// InsertBlock validates, executes and writes the block, making it the new head
+// if it outweighs the current one. A block whose parent is not known yet is
+// screened with the checks that need no parent and, if it passes, kept until
+// the parent is inserted; ErrBlockQueued is returned in that case.
 func (bc *BlockChain) InsertBlock(block *types.Block) error {
 
-	err := bc.validate(block)
-	if err != nil {
-		return err
+	bc.chainmu.Lock()
+	var events []ReorgEvent
+	oldHead := bc.CurrentBlock()
+	event, err := bc.insertBlock(block)
+	switch {
+	case errors.Is(err, ErrUnknownAncestor):
+		// The parent is not known yet, keep the block until it arrives unless
+		// it already fails the checks that need no parent
+		if err = bc.validator.ValidateSanity(block); err == nil {
+			bc.orphans.add(block)
+			err = ErrBlockQueued
+		}
+
+	case err == nil:
+		if event != nil {
+			events = append(events, *event)
+		}
+		events = append(events, bc.connectOrphans(block.Hash())...)
+	}
+	newHead := bc.CurrentBlock()
+	bc.chainmu.Unlock()
+
+	// Notify subscribers outside of the chain lock
+	for _, ev := range events {
+		bc.postReorgEvent(ev)
+	}
+	if newHead != oldHead {
+		bc.postChainHeadEvent(ChainHeadEvent{Block: newHead})
+	}
+	return err
+}
+
+// connectOrphans inserts all orphans that were waiting on the given, freshly
+// inserted block, recursively connecting their own orphaned descendants.
+func (bc *BlockChain) connectOrphans(hash common.Hash) []ReorgEvent {
+
+	var events []ReorgEvent
+
+	queue := bc.orphans.take(hash)
+	for len(queue) > 0 {
+		block := queue[0]
+		queue = queue[1:]
+
+		event, err := bc.insertBlock(block)
+		if err != nil {
+			log.Printf("Discarded orphan block, number %d, hash %x: %v", block.NumberU64(), block.Hash(), err)
+			continue
+		}
+		if event != nil {
+			events = append(events, *event)
+		}
+		queue = append(queue, bc.orphans.take(block.Hash())...)
 	}
+	return events
+}
 
-	// receipts, usedGas, err := bc.processor.Process(block, statedb, bc.vmConfig)
+// insertBlock is the internal implementation of InsertBlock, which assumes the
+// chain mutex is held. It returns the reorg event to post, if any.
+func (bc *BlockChain) insertBlock(block *types.Block) (*ReorgEvent, error) {
 
-	if err := bc.writeBlockWithState(block, receipts, statedb); err != nil {
-		return err
+	// The first block inserted into an empty chain becomes its genesis
+	if bc.CurrentBlock() == nil {
+		return nil, bc.insertGenesis(block)
+	}
+
+	parent, err := bc.validate(block)
+	if err != nil {
+		return nil, err
 	}
 
-	err = bc.blockSetHead(block)
+	// Execute the block on top of the parent state
+	statedb, err := state.New(parent.Root(), bc.stateCache)
+	if err != nil {
+		return nil, err
+	}
+	receipts, usedGas, err := bc.processor.Process(block, statedb)
+	if err != nil {
+		return nil, err
+	}
+	// Only accept the resulting state if it matches what the header claims
+	if err := bc.validator.ValidateState(block, statedb, receipts, usedGas); err != nil {
+		return nil, err
+	}
+
+	return bc.writeBlockWithState(block, receipts, statedb)
+}
+
+// insertGenesis writes the first block of an empty chain and makes it the head.
+// The genesis block is not executed, its state is taken as given.
+func (bc *BlockChain) insertGenesis(block *types.Block) error {
+	_, err := bc.writeBlockWithState(block, nil, nil)
 	return err
 }
 
-func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) error {
+// writeBlockWithState writes the block and all associated state to the database
+// and makes it the new head if it extends or outweighs the canonical chain. The
+// state is optional and only committed if given. It returns the reorg event to
+// post, if any.
+//
+// The state is committed first and the block, together with any canonical and
+// head marker changes, is then flushed in a single batch. A crash in between
+// thus at worst leaves unreferenced state behind, but the head never points at
+// a block whose state or body is missing.
+func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.Receipt, state *state.StateDB) (*ReorgEvent, error) {
+
+	// Calculate the total difficulty of the block. The genesis block has no
+	// stored parent and starts the sum with its own difficulty.
+	externTd := block.Difficulty()
+	if bc.CurrentBlock() != nil {
+		ptd := bc.GetTd(block.ParentHash(), block.NumberU64()-1)
+		if ptd == nil {
+			return nil, ErrUnknownAncestor
+		}
+		externTd.Add(externTd, ptd)
+	}
+
+	// Commit all cached state changes into underlying memory database.
+	if state != nil {
+		root, err := state.Commit(true)
+		if err != nil {
+			return nil, err
+		}
+		if err := bc.stateCache.TrieDB().Commit(root, false, nil); err != nil {
+			return nil, err
+		}
+	}
 
 	// Irrelevant of the canonical status, write the block itself to the database.
 	//
 	// Note all the components of block(td, hash->number map, header, body, receipts)
-	// should be written atomically. BlockBatch is used for containing all components.
+	// should be written atomically, together with the head markers if the block
+	// becomes the head. BlockBatch is used for containing all components.
 	blockBatch := bc.db.NewBatch()
+	rawdb.WriteTd(blockBatch, block.Hash(), block.NumberU64(), externTd)
 	rawdb.WriteBlock(blockBatch, block)
 	rawdb.WriteReceipts(blockBatch, block.Hash(), block.NumberU64(), receipts)
+
+	event, head, err := bc.blockSetHead(blockBatch, block, externTd)
+	if err != nil {
+		return nil, err
+	}
 	if err := blockBatch.Write(); err != nil {
-		log.Fatal("Failed to write block into disk", "err", err)
+		return nil, fmt.Errorf("failed to write block into disk: %w", err)
 	}
-	// Commit all cached state changes into underlying memory database.
-	root, err := state.Commit(true)
-	if err != nil {
-		return err
+	if head {
+		bc.currentBlock.Store(block)
+	}
+	return event, nil
+}
+
+// validate checks a block against its own parent, which may sit on the
+// canonical chain or on any known side chain, and returns that parent.
+func (bc *BlockChain) validate(b *types.Block) (*types.Block, error) {
+
+	if bc.HasBlock(b.Hash(), b.NumberU64()) {
+		return nil, ErrKnownBlock
+	}
+	if b.NumberU64() == 0 {
+		return nil, ErrInvalidNumber
+	}
+	parent := bc.GetBlock(b.ParentHash(), b.NumberU64()-1)
+	if parent == nil {
+		return nil, ErrUnknownAncestor
 	}
-	triedb := bc.db.TrieDB()
 
-	return triedb.Commit(root, false, nil)
+	if err := bc.validator.ValidateHeader(b.Header(), parent.Header()); err != nil {
+		return nil, err
+	}
+	if err := bc.validator.ValidateBody(b); err != nil {
+		return nil, err
+	}
+	return parent, nil
 }
 
-func (bc *BlockChain) validate(b *types.Block) error {
+// blockSetHead stages the canonical and head marker changes into the batch if
+// the block, of total difficulty externTd, extends the canonical chain or
+// outweighs it, reorganising the chain in the latter case. It reports whether
+// the block becomes the new head.
+func (bc *BlockChain) blockSetHead(batch accdb.Batch, block *types.Block, externTd *big.Int) (*ReorgEvent, bool, error) {
 
 	currentBlock := bc.CurrentBlock()
 
-	if !isValid(b, currentBlock) {
-		return errors.New("Invalid Block.")
+	var event *ReorgEvent
+
+	// Blocks extending the current head never need a reorg
+	if currentBlock != nil && block.ParentHash() != currentBlock.Hash() {
+		localTd := bc.GetTd(currentBlock.Hash(), currentBlock.NumberU64())
+		if localTd == nil {
+			return nil, false, errMissingTd
+		}
+		if !reorgNeeded(currentBlock, localTd, block, externTd) {
+			// CanonStatTy: the block stays on a side chain
+			return nil, false, nil
+		}
+		// Reorganise the chain since the parent is not the head block
+		var err error
+		if event, err = bc.reorg(batch, currentBlock, block); err != nil {
+			return nil, false, err
+		}
 	}
 
-	return nil
+	// Set new head.
+	writeHeadBlock(batch, block)
+	return event, true, nil
 }
 
-func isValid(newBlock *types.Block, prevBlock *types.Block) bool {
+// writeHeadBlock stages a new head block into the batch. This method assumes
+// that the block is indeed a true head. The canonical mapping and the head
+// pointer are flushed together with the block and any pending reorg changes
+// in the batch, so a crash never leaves the head pointing at a non-canonical
+// or missing block.
+func writeHeadBlock(batch accdb.Batch, block *types.Block) {
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteHeadBlockHash(batch, block.Hash())
+}
+
+// ReorgNeeded returns whether the reorg should be applied based on the given
+// external block and the local canonical head. The chain with the higher total
+// difficulty wins. On a tie the shorter chain is preferred since it reached the
+// same work with fewer blocks; otherwise the first seen head is kept.
+func (bc *BlockChain) ReorgNeeded(current *types.Block, block *types.Block) (bool, error) {
 
-	checkNum := prevBlock.NumberU64() + 1
-	if newBlock.NumberU64() != checkNum {
-		return false
+	localTD := bc.GetTd(current.Hash(), current.NumberU64())
+	externTd := bc.GetTd(block.Hash(), block.NumberU64())
+	if localTD == nil || externTd == nil {
+		return false, errMissingTd
 	}
-	if newBlock.ParentHash() != prevBlock.Hash() {
-		return false
+	return reorgNeeded(current, localTD, block, externTd), nil
+}
+
+// reorgNeeded implements ReorgNeeded for known total difficulties.
+func reorgNeeded(current *types.Block, localTD *big.Int, block *types.Block, externTd *big.Int) bool {
+	if diff := externTd.Cmp(localTD); diff != 0 {
+		return diff > 0
 	}
-	return true
+	return block.NumberU64() < current.NumberU64()
 }
 
-func (bc *BlockChain) blockSetHead(block *types.Block) (err error) {
+// reorg takes two blocks, an old chain and a new chain and will reconstruct the
+// blocks and inserts them to be part of the new canonical chain. The canonical
+// mapping changes are staged into the given batch and the dropped and added
+// blocks are returned as a reorg event.
+func (bc *BlockChain) reorg(batch accdb.Batch, oldBlock, newBlock *types.Block) (*ReorgEvent, error) {
 
-	currentBlock := bc.CurrentBlock()
-	reorg, err := bc.ReorgNeeded(currentBlock, block)
-	if err != nil {
-		return err
-	}
+	var (
+		newChain []*types.Block
+		oldChain []*types.Block
+		newHead  = newBlock
+	)
 
-	if reorg {
-		// Reorganise the chain if the parent is not the head block
-		if block.ParentHash() != currentBlock.Hash() {
-			if err := bc.reorg(currentBlock, block); err != nil {
-				return err
-			}
+	// Reduce the longer chain to the same number as the shorter one
+	if oldBlock.NumberU64() > newBlock.NumberU64() {
+		// Old chain is longer, gather all blocks it drops
+		for ; oldBlock != nil && oldBlock.NumberU64() != newBlock.NumberU64(); oldBlock = bc.GetBlock(oldBlock.ParentHash(), oldBlock.NumberU64()-1) {
+			oldChain = append(oldChain, oldBlock)
+		}
+	} else {
+		// New chain is longer, stash all blocks away for subsequent insertion
+		for ; newBlock != nil && newBlock.NumberU64() != oldBlock.NumberU64(); newBlock = bc.GetBlock(newBlock.ParentHash(), newBlock.NumberU64()-1) {
+			newChain = append(newChain, newBlock)
 		}
-		// CanonStatTy
-
-		// Set new head.
-		bc.writeHeadBlock(block)
 	}
-	return nil
-}
+	if oldBlock == nil {
+		return nil, errInvalidOldChain
+	}
+	if newBlock == nil {
+		return nil, errInvalidNewChain
+	}
 
-func (bc *BlockChain) writeHeadBlock(block *types.Block) {
+	// Both sides of the reorg are at the same number, reduce both until the common
+	// ancestor is found
+	for oldBlock.Hash() != newBlock.Hash() {
+		// Remove an old block as well as stash away a new block
+		oldChain = append(oldChain, oldBlock)
+		newChain = append(newChain, newBlock)
 
-	bc.currentBlock.Store(block)
-}
+		// Step back with both chains
+		oldBlock = bc.GetBlock(oldBlock.ParentHash(), oldBlock.NumberU64()-1)
+		if oldBlock == nil {
+			return nil, errInvalidOldChain
+		}
+		newBlock = bc.GetBlock(newBlock.ParentHash(), newBlock.NumberU64()-1)
+		if newBlock == nil {
+			return nil, errInvalidNewChain
+		}
+	}
 
-func (bc *BlockChain) ReorgNeeded(current *types.Block, block *types.Block) (bool, error) {
+	// Insert the new chain (except the head block, which writeHeadBlock covers),
+	// taking care of the proper incremental order.
+	for i := len(newChain) - 1; i >= 1; i-- {
+		rawdb.WriteCanonicalHash(batch, newChain[i].Hash(), newChain[i].NumberU64())
+	}
 
-	reorg := false
-	return reorg, nil
-}
+	// Delete any canonical number assignments above the new head
+	for i := newHead.NumberU64() + 1; ; i++ {
+		hash := rawdb.ReadCanonicalHash(bc.db, i)
+		if hash == (common.Hash{}) {
+			break
+		}
+		rawdb.DeleteCanonicalHash(batch, i)
+	}
 
-func (bc *BlockChain) reorg(oldBlock, newBlock *types.Block) error {
-	return nil
+	log.Printf("Chain reorg detected, number %d, drop %d, add %d", oldBlock.NumberU64(), len(oldChain), len(newChain))
 
+	return &ReorgEvent{OldChain: oldChain, NewChain: newChain}, nil
 }
@@ -0,0 +1,84 @@
+package chain
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/params"
+)
+
+const (
+	InitialBaseFee           uint64 = 1000000000 // Initial base fee for EIP-1559 blocks.
+	BaseFeeChangeDenominator uint64 = 8          // Bounds the amount the base fee can change between blocks.
+	ElasticityMultiplier     uint64 = 2          // Bounds the maximum gas limit an EIP-1559 block may have.
+)
+
+// verifyEip1559Header verifies some header attributes which were changed in
+// EIP-1559:
+// - gas limit check
+// - basefee check
+func verifyEip1559Header(config *params.ChainConfig, parent, header *types.Header) error {
+	// Verify that the gas limit remains within allowed bounds
+	parentGasLimit := parent.GasLimit
+	if !config.IsLondon(new(big.Int).SetUint64(parent.Number)) {
+		parentGasLimit = parent.GasLimit * ElasticityMultiplier
+	}
+	if err := verifyGasLimit(parentGasLimit, header.GasLimit); err != nil {
+		return err
+	}
+	// Verify the header is not malformed
+	if header.BaseFee == nil {
+		return fmt.Errorf("%w: header is missing baseFee", ErrInvalidBaseFee)
+	}
+	// Verify the baseFee is correct based on the parent header.
+	expectedBaseFee := CalcBaseFee(config, parent)
+	if header.BaseFee.Cmp(expectedBaseFee) != 0 {
+		return fmt.Errorf("%w: have %s, want %s, parentBaseFee %s, parentGasUsed %d",
+			ErrInvalidBaseFee, header.BaseFee, expectedBaseFee, parent.BaseFee, parent.GasUsed)
+	}
+	return nil
+}
+
+// CalcBaseFee calculates the basefee of the header.
+func CalcBaseFee(config *params.ChainConfig, parent *types.Header) *big.Int {
+	// If the current block is the first EIP-1559 block, return the InitialBaseFee.
+	if !config.IsLondon(new(big.Int).SetUint64(parent.Number)) {
+		return new(big.Int).SetUint64(InitialBaseFee)
+	}
+
+	var (
+		parentGasTarget          = parent.GasLimit / ElasticityMultiplier
+		parentGasTargetBig       = new(big.Int).SetUint64(parentGasTarget)
+		baseFeeChangeDenominator = new(big.Int).SetUint64(BaseFeeChangeDenominator)
+	)
+	// If the parent gasUsed is the same as the target, the baseFee remains unchanged.
+	if parent.GasUsed == parentGasTarget {
+		return new(big.Int).Set(parent.BaseFee)
+	}
+	if parent.GasUsed > parentGasTarget {
+		// If the parent block used more gas than its target, the baseFee should increase.
+		gasUsedDelta := new(big.Int).SetUint64(parent.GasUsed - parentGasTarget)
+		x := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+		y := x.Div(x, parentGasTargetBig)
+		baseFeeDelta := y.Div(y, baseFeeChangeDenominator)
+		if baseFeeDelta.Cmp(common1) < 0 {
+			baseFeeDelta = common1
+		}
+		return x.Add(parent.BaseFee, baseFeeDelta)
+	} else {
+		// Otherwise if the parent block used less gas than its target, the baseFee should decrease.
+		gasUsedDelta := new(big.Int).SetUint64(parentGasTarget - parent.GasUsed)
+		x := new(big.Int).Mul(parent.BaseFee, gasUsedDelta)
+		y := x.Div(x, parentGasTargetBig)
+		baseFeeDelta := y.Div(y, baseFeeChangeDenominator)
+
+		baseFee := x.Sub(parent.BaseFee, baseFeeDelta)
+		if baseFee.Sign() < 0 {
+			baseFee.SetUint64(0)
+		}
+		return baseFee
+	}
+}
+
+var common1 = big.NewInt(1)
@@ -1,8 +1,74 @@
 package chain
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/universe-30/mt-bc/consensus"
+)
 
 var (
+	// ErrUnknownAncestor is returned when validating a block requires an ancestor
+	// that is unknown.
+	ErrUnknownAncestor = consensus.ErrUnknownAncestor
+
+	// ErrBlockQueued is returned when a block whose parent is unknown passed the
+	// checks that need no parent and was queued until the parent arrives. The
+	// block is neither rejected nor part of the chain yet.
+	ErrBlockQueued = errors.New("block queued, parent unknown")
+
+	// ErrKnownBlock is returned when a block to import is already known locally.
+	ErrKnownBlock = errors.New("block already known")
+
+	// ErrInvalidNumber is returned if a block's number is not its parent's plus one.
+	ErrInvalidNumber = consensus.ErrInvalidNumber
+
+	// ErrFutureBlock is returned when a block's timestamp is in the future according
+	// to the current node.
+	ErrFutureBlock = consensus.ErrFutureBlock
+
+	// ErrOlderBlockTime is returned if a block's timestamp is not strictly greater
+	// than its parent's.
+	ErrOlderBlockTime = errors.New("timestamp older than parent")
+
+	// ErrInvalidGasLimit is returned if a block's gas limit is out of the bounds
+	// allowed in relation to its parent.
+	ErrInvalidGasLimit = errors.New("invalid gas limit")
+
+	// ErrInvalidGasUsed is returned if a block claims to use more gas than its
+	// gas limit.
+	ErrInvalidGasUsed = errors.New("invalid gas used")
+
+	// ErrTxHashMismatch is returned if a block's TxHash does not commit to the
+	// transactions in its body.
+	ErrTxHashMismatch = errors.New("transaction root hash mismatch")
+
+	// ErrInvalidSeal is returned if the proof-of-work or signature sealing a
+	// block doesn't verify.
+	ErrInvalidSeal = consensus.ErrInvalidSeal
+
+	// ErrReceiptHashMismatch is returned if the receipts produced by processing a
+	// block do not match the header's ReceiptHash.
+	ErrReceiptHashMismatch = errors.New("invalid receipt root hash")
+
+	// ErrBloomMismatch is returned if the logs produced by processing a block do
+	// not match the header's LogsBloom.
+	ErrBloomMismatch = errors.New("invalid bloom")
+
+	// ErrGasUsedMismatch is returned if the gas used by processing a block does
+	// not match the header's GasUsed.
+	ErrGasUsedMismatch = errors.New("invalid gas used by block execution")
+
+	// ErrStateRootMismatch is returned if the state produced by processing a block
+	// does not match the header's Root.
+	ErrStateRootMismatch = errors.New("invalid merkle root")
+
+	// ErrInvalidBaseFee is returned if a block's base fee is missing before or
+	// present after London, or does not follow from its parent's.
+	ErrInvalidBaseFee = errors.New("invalid base fee")
+
+	// ErrInvalidProof is returned if a Merkle proof does not authenticate the
+	// item it claims against the trusted header.
+	ErrInvalidProof = errors.New("invalid merkle proof")
 
 	// ErrGasLimitReached is returned by the gas pool if the amount of gas required
 	// by a transaction is higher than what's left in the block.
@@ -15,4 +81,46 @@ var (
 	// ErrInsufficientFunds is returned if the total cost of executing a transaction
 	// is higher than the balance of the user's account.
 	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+
+	// ErrGasUintOverflow is returned when calculating gas usage.
+	ErrGasUintOverflow = errors.New("gas uint64 overflow")
+
+	// ErrNonceTooLow is returned if the nonce of a transaction is lower than the
+	// one present in the local chain.
+	ErrNonceTooLow = errors.New("nonce too low")
+
+	// ErrNonceTooHigh is returned if the nonce of a transaction is higher than the
+	// next one expected based on the local chain.
+	ErrNonceTooHigh = errors.New("nonce too high")
+
+	// ErrNonceMax is returned if the nonce of a transaction sender account has
+	// maximum allowed value and would become invalid if incremented.
+	ErrNonceMax = errors.New("nonce has max value")
+
+	// ErrSenderNoEOA is returned if the sender of a transaction is a contract.
+	ErrSenderNoEOA = errors.New("sender not an eoa")
+
+	// ErrIntrinsicGas is returned if the transaction is specified to use less gas
+	// than required to start the invocation.
+	ErrIntrinsicGas = errors.New("intrinsic gas too low")
+
+	// ErrTipAboveFeeCap is a sanity error to ensure no one is able to specify a
+	// transaction with a tip higher than the total fee cap.
+	ErrTipAboveFeeCap = errors.New("max priority fee per gas higher than max fee per gas")
+
+	// ErrTipVeryHigh is a sanity error to avoid extremely big numbers specified
+	// in the tip field.
+	ErrTipVeryHigh = errors.New("max priority fee per gas higher than 2^256-1")
+
+	// ErrFeeCapVeryHigh is a sanity error to avoid extremely big numbers specified
+	// in the fee cap field.
+	ErrFeeCapVeryHigh = errors.New("max fee per gas higher than 2^256-1")
+
+	// ErrFeeCapTooLow is returned if the transaction fee cap is less than the
+	// the base fee of the block.
+	ErrFeeCapTooLow = errors.New("max fee per gas less than block base fee")
+
+	// ErrTxTypeNotSupported is returned if a transaction is not supported in the
+	// current network configuration.
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
 )
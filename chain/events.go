@@ -0,0 +1,123 @@
+package chain
+
+import (
+	"sync"
+
+	"github.com/universe-30/mt-bc/chain/types"
+)
+
+// ReorgEvent is posted when the canonical chain switches over to a heavier
+// side chain. Both block lists are ordered from the highest block downwards
+// and stop just above the common ancestor.
+type ReorgEvent struct {
+	OldChain []*types.Block // Blocks dropped from the canonical chain
+	NewChain []*types.Block // Blocks that became canonical
+}
+
+// ChainHeadEvent is posted whenever a block becomes the new canonical head,
+// whether it extends the previous head or wins a reorg.
+type ChainHeadEvent struct {
+	Block *types.Block
+}
+
+// reorgSub is a single ReorgEvent subscription. The quit channel is closed on
+// unsubscribe, releasing a delivery blocked on a channel nobody reads anymore.
+type reorgSub struct {
+	ch   chan<- ReorgEvent
+	quit chan struct{}
+}
+
+// chainHeadSub is a single ChainHeadEvent subscription, see reorgSub.
+type chainHeadSub struct {
+	ch   chan<- ChainHeadEvent
+	quit chan struct{}
+}
+
+// SubscribeReorgEvent registers a subscription of ReorgEvent. Events are
+// delivered synchronously once the triggering insertion has finished, so the
+// channel must be drained until the subscription is cancelled. The returned
+// function cancels the subscription; it also aborts a delivery to ch that is
+// in progress, so it is safe to call without draining the channel.
+func (bc *BlockChain) SubscribeReorgEvent(ch chan<- ReorgEvent) func() {
+	bc.feedmu.Lock()
+	defer bc.feedmu.Unlock()
+
+	sub := &reorgSub{ch: ch, quit: make(chan struct{})}
+	bc.reorgFeed = append(bc.reorgFeed, sub)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			bc.feedmu.Lock()
+			defer bc.feedmu.Unlock()
+
+			for i, s := range bc.reorgFeed {
+				if s == sub {
+					bc.reorgFeed = append(bc.reorgFeed[:i], bc.reorgFeed[i+1:]...)
+					break
+				}
+			}
+			close(sub.quit)
+		})
+	}
+}
+
+// postReorgEvent delivers a reorg notification to all current subscribers.
+// Subscribers unsubscribing during the delivery are skipped.
+func (bc *BlockChain) postReorgEvent(ev ReorgEvent) {
+	bc.feedmu.Lock()
+	subs := make([]*reorgSub, len(bc.reorgFeed))
+	copy(subs, bc.reorgFeed)
+	bc.feedmu.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.ch <- ev:
+		case <-sub.quit:
+		}
+	}
+}
+
+// SubscribeChainHeadEvent registers a subscription of ChainHeadEvent. Like reorg
+// events, head events are delivered synchronously after the insertion, and
+// always after the reorg event that caused them, if any. The returned function
+// cancels the subscription, aborting a delivery in progress.
+func (bc *BlockChain) SubscribeChainHeadEvent(ch chan<- ChainHeadEvent) func() {
+	bc.feedmu.Lock()
+	defer bc.feedmu.Unlock()
+
+	sub := &chainHeadSub{ch: ch, quit: make(chan struct{})}
+	bc.headFeed = append(bc.headFeed, sub)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			bc.feedmu.Lock()
+			defer bc.feedmu.Unlock()
+
+			for i, s := range bc.headFeed {
+				if s == sub {
+					bc.headFeed = append(bc.headFeed[:i], bc.headFeed[i+1:]...)
+					break
+				}
+			}
+			close(sub.quit)
+		})
+	}
+}
+
+// postChainHeadEvent delivers a head notification to all current subscribers.
+// Subscribers unsubscribing during the delivery are skipped.
+func (bc *BlockChain) postChainHeadEvent(ev ChainHeadEvent) {
+	bc.feedmu.Lock()
+	subs := make([]*chainHeadSub, len(bc.headFeed))
+	copy(subs, bc.headFeed)
+	bc.feedmu.Unlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.ch <- ev:
+		case <-sub.quit:
+		}
+	}
+}
@@ -8,7 +8,8 @@ import (
 	"github.com/universe-30/mt-trie/common"
 )
 
-func NewEVMBlockContext(header *types.Header, author *common.Address) vm.BlockContext {
+// NewEVMBlockContext creates a new context for use in the EVM.
+func NewEVMBlockContext(header *types.Header, chain ChainContext, author *common.Address) vm.BlockContext {
 	var (
 		beneficiary common.Address
 	)
@@ -16,19 +17,67 @@ func NewEVMBlockContext(header *types.Header, author *common.Address) vm.BlockCo
 	// If we don't have an explicit author (i.e. not mining), extract from the header
 	if author == nil {
 		beneficiary = header.Coinbase
+		if engine := chain.Engine(); engine != nil {
+			beneficiary, _ = engine.Author(header) // Ignore error, we're past header validation
+		}
 	} else {
 		beneficiary = *author
 	}
 
+	difficulty := new(big.Int)
+	if header.Difficulty != nil {
+		difficulty.Set(header.Difficulty)
+	}
+
 	return vm.BlockContext{
-		Coinbase: beneficiary,
-		BaseFee:  header.BaseFee,
+		GetHash:     GetHashFn(header, chain),
+		Coinbase:    beneficiary,
+		GasLimit:    header.GasLimit,
+		BlockNumber: new(big.Int).SetUint64(header.Number),
+		Time:        new(big.Int).SetUint64(header.Time),
+		Difficulty:  difficulty,
+		BaseFee:     header.BaseFee,
 	}
 }
 
+// NewEVMTxContext creates a new transaction context for a single transaction.
 func NewEVMTxContext(msg Message) vm.TxContext {
 	return vm.TxContext{
 		Origin:   msg.From(),
 		GasPrice: new(big.Int).Set(msg.GasPrice()),
 	}
 }
+
+// GetHashFn returns a GetHashFunc which retrieves header hashes by number
+func GetHashFn(ref *types.Header, chain ChainContext) func(n uint64) common.Hash {
+	// Cache will initially contain [refHash.parent],
+	// Then fill up with [refHash.p, refHash.pp, refHash.ppp, ...]
+	var cache []common.Hash
+
+	return func(n uint64) common.Hash {
+		// If there's no hash cache yet, make one
+		if len(cache) == 0 {
+			cache = append(cache, ref.ParentHash)
+		}
+		if idx := ref.Number - n - 1; idx < uint64(len(cache)) {
+			return cache[idx]
+		}
+		// No luck in the cache, but we can start iterating from the last element we already know
+		lastKnownHash := cache[len(cache)-1]
+		lastKnownNumber := ref.Number - uint64(len(cache))
+
+		for {
+			header := chain.GetHeader(lastKnownHash, lastKnownNumber)
+			if header == nil {
+				break
+			}
+			cache = append(cache, header.ParentHash)
+			lastKnownHash = header.ParentHash
+			lastKnownNumber = header.Number - 1
+			if n == lastKnownNumber {
+				return lastKnownHash
+			}
+		}
+		return common.Hash{}
+	}
+}
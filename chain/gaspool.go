@@ -28,6 +28,12 @@ func (gp *GasPool) SubGas(amount uint64) error {
 	return nil
 }
 
+// SetGas sets the amount of gas available in the pool, restoring it to a
+// value previously read with Gas.
+func (gp *GasPool) SetGas(gas uint64) {
+	*(*uint64)(gp) = gas
+}
+
 // Gas returns the amount of gas remaining in the pool.
 func (gp *GasPool) Gas() uint64 {
 	return uint64(*gp)
@@ -1,23 +1,312 @@
 package chain
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/universe-30/mt-bc/chain/rawdb"
+	"github.com/universe-30/mt-bc/chain/state"
 	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/common/hexutil"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
 )
 
+// GenesisGasLimit is the gas limit of the genesis block.
+const GenesisGasLimit uint64 = 4712388
+
+// GenesisDifficulty is the difficulty of the genesis block if none is specified.
+var GenesisDifficulty = big.NewInt(1)
+
+var errGenesisNoConfig = errors.New("genesis has no chain configuration")
+
+// Genesis specifies the header fields and state of a genesis block. It also
+// defines the chain configuration the network identified by it runs with.
+//
+// In JSON, the quantities and binary fields of the genesis and its accounts are
+// 0x-prefixed hex strings, as in the genesis files of Ethereum clients.
 type Genesis struct {
+	Config     *params.ChainConfig `json:"config"`
+	Timestamp  uint64              `json:"timestamp"`
+	GasLimit   uint64              `json:"gasLimit"`
+	Difficulty *big.Int            `json:"difficulty"`
+	Coinbase   common.Address      `json:"coinbase"`
+	ExtraData  []byte              `json:"extraData"`
+	Alloc      GenesisAlloc        `json:"alloc"`
 }
 
-// 生成创世区块
-func CreateGenesisBlock() *types.Block {
+// GenesisAlloc specifies the initial state that is part of the genesis block.
+type GenesisAlloc map[common.Address]GenesisAccount
+
+// GenesisAccount is an account in the state of the genesis block.
+type GenesisAccount struct {
+	Code    []byte                      `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Balance *big.Int                    `json:"balance"`
+	Nonce   uint64                      `json:"nonce,omitempty"`
+}
+
+// genesisJSON is the JSON encoding of Genesis.
+type genesisJSON struct {
+	Config     *params.ChainConfig `json:"config"`
+	Timestamp  hexutil.Uint64      `json:"timestamp"`
+	GasLimit   hexutil.Uint64      `json:"gasLimit"`
+	Difficulty *hexutil.Big        `json:"difficulty"`
+	Coinbase   common.Address      `json:"coinbase"`
+	ExtraData  hexutil.Bytes       `json:"extraData"`
+	Alloc      GenesisAlloc        `json:"alloc"`
+}
+
+// MarshalJSON marshals as JSON.
+func (g Genesis) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&genesisJSON{
+		Config:     g.Config,
+		Timestamp:  hexutil.Uint64(g.Timestamp),
+		GasLimit:   hexutil.Uint64(g.GasLimit),
+		Difficulty: (*hexutil.Big)(g.Difficulty),
+		Coinbase:   g.Coinbase,
+		ExtraData:  g.ExtraData,
+		Alloc:      g.Alloc,
+	})
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (g *Genesis) UnmarshalJSON(input []byte) error {
+	var dec genesisJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	g.Config = dec.Config
+	g.Timestamp = uint64(dec.Timestamp)
+	g.GasLimit = uint64(dec.GasLimit)
+	g.Difficulty = (*big.Int)(dec.Difficulty)
+	g.Coinbase = dec.Coinbase
+	g.ExtraData = dec.ExtraData
+	g.Alloc = dec.Alloc
+	return nil
+}
+
+// genesisAccountJSON is the JSON encoding of GenesisAccount.
+type genesisAccountJSON struct {
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   hexutil.Uint64              `json:"nonce,omitempty"`
+}
+
+// MarshalJSON marshals as JSON.
+func (a GenesisAccount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&genesisAccountJSON{
+		Code:    a.Code,
+		Storage: a.Storage,
+		Balance: (*hexutil.Big)(a.Balance),
+		Nonce:   hexutil.Uint64(a.Nonce),
+	})
+}
 
-	header := &types.Header{}
-	header.Number = 0
+// UnmarshalJSON unmarshals from JSON.
+func (a *GenesisAccount) UnmarshalJSON(input []byte) error {
+	var dec genesisAccountJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Balance == nil {
+		return errors.New("missing required field 'balance' for GenesisAccount")
+	}
+	a.Code = dec.Code
+	a.Storage = dec.Storage
+	a.Balance = (*big.Int)(dec.Balance)
+	a.Nonce = uint64(dec.Nonce)
+	return nil
+}
 
-	blk := types.NewBlockWithHeader(header)
-	blk.Txs = nil
+// GenesisMismatchError is raised when trying to overwrite an existing
+// genesis block with an incompatible one.
+type GenesisMismatchError struct {
+	Stored, New common.Hash
+}
 
-	data := types.NewTxWithString("Genesis Block")
-	txs := []*types.Transaction{data}
+func (e *GenesisMismatchError) Error() string {
+	return fmt.Sprintf("database contains incompatible genesis (have %x, new %x)", e.Stored, e.New)
+}
 
-	return types.CreateNewBlock(blk, txs)
+// LoadGenesis reads a JSON encoded genesis specification from the given file.
+func LoadGenesis(path string) (*Genesis, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	genesis := new(Genesis)
+	if err := json.NewDecoder(file).Decode(genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis file: %v", err)
+	}
+	return genesis, nil
+}
+
+// SetupGenesisBlock writes or updates the genesis block in db.
+// The block that will be used is:
+//
+//	                     genesis == nil       genesis != nil
+//	                  +------------------------------------------
+//	db has no genesis |  main-net default  |  genesis
+//	db has genesis    |  from DB           |  genesis (if compatible)
+//
+// The stored chain configuration is returned along with the genesis hash. If
+// the database already holds a different genesis block, a *GenesisMismatchError
+// is returned together with the stored hash.
+func SetupGenesisBlock(db accdb.Database, genesis *Genesis) (*params.ChainConfig, common.Hash, error) {
+	if genesis != nil && genesis.Config == nil {
+		return params.MainnetChainConfig, common.Hash{}, errGenesisNoConfig
+	}
+	// Just commit the new block if there is no stored genesis block.
+	stored := rawdb.ReadCanonicalHash(db, 0)
+	if stored == (common.Hash{}) {
+		if genesis == nil {
+			log.Printf("Writing default main-net genesis block")
+			genesis = DefaultGenesisBlock()
+		} else {
+			log.Printf("Writing custom genesis block")
+		}
+		block, err := genesis.Commit(db)
+		if err != nil {
+			return genesis.Config, common.Hash{}, err
+		}
+		return genesis.Config, block.Hash(), nil
+	}
+	// Check whether the genesis block is already written.
+	if genesis != nil {
+		if hash := genesis.ToBlock(nil).Hash(); hash != stored {
+			return genesis.Config, stored, &GenesisMismatchError{stored, hash}
+		}
+	}
+	// Get the existing chain configuration.
+	newcfg := params.MainnetChainConfig
+	if genesis != nil {
+		newcfg = genesis.Config
+	}
+	if err := newcfg.CheckConfigForkOrder(); err != nil {
+		return newcfg, common.Hash{}, err
+	}
+	storedcfg := rawdb.ReadChainConfig(db, stored)
+	if storedcfg == nil {
+		log.Printf("Found genesis block without chain config")
+		rawdb.WriteChainConfig(db, stored, newcfg)
+		return newcfg, stored, nil
+	}
+	// Special case: don't change the existing config of a non-mainnet chain if
+	// no new config is supplied.
+	if genesis == nil {
+		return storedcfg, stored, nil
+	}
+	rawdb.WriteChainConfig(db, stored, newcfg)
+	return newcfg, stored, nil
+}
+
+// ToBlock creates the genesis block and writes state of a genesis specification
+// to the given database (or discards it if nil).
+func (g *Genesis) ToBlock(db accdb.Database) *types.Block {
+	if db == nil {
+		db = memorydb.New()
+	}
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db))
+	if err != nil {
+		panic(err)
+	}
+	for addr, account := range g.Alloc {
+		if account.Balance != nil {
+			statedb.AddBalance(addr, account.Balance)
+		}
+		statedb.SetCode(addr, account.Code)
+		statedb.SetNonce(addr, account.Nonce)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+	root := statedb.IntermediateRoot(false)
+	head := &types.Header{
+		Number:     0,
+		Time:       g.Timestamp,
+		Extra:      g.ExtraData,
+		GasLimit:   g.GasLimit,
+		Difficulty: g.Difficulty,
+		Coinbase:   g.Coinbase,
+		Root:       root,
+	}
+	if g.GasLimit == 0 {
+		head.GasLimit = GenesisGasLimit
+	}
+	if g.Difficulty == nil {
+		head.Difficulty = GenesisDifficulty
+	}
+	if g.Config != nil && g.Config.IsLondon(new(big.Int)) {
+		head.BaseFee = new(big.Int).SetUint64(InitialBaseFee)
+	}
+	if _, err := statedb.Commit(false); err != nil {
+		panic(err)
+	}
+	if err := statedb.Database().TrieDB().Commit(root, true, nil); err != nil {
+		panic(err)
+	}
+	return types.NewBlock(head, nil, nil)
+}
+
+// Commit writes the block and state of a genesis specification to the database.
+// The block is committed as the canonical head block.
+func (g *Genesis) Commit(db accdb.Database) (*types.Block, error) {
+	block := g.ToBlock(db)
+	if block.NumberU64() != 0 {
+		return nil, errors.New("can't commit genesis block with number > 0")
+	}
+	config := g.Config
+	if config == nil {
+		config = params.MainnetChainConfig
+	}
+	if err := config.CheckConfigForkOrder(); err != nil {
+		return nil, err
+	}
+	batch := db.NewBatch()
+	rawdb.WriteTd(batch, block.Hash(), block.NumberU64(), block.Difficulty())
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), nil)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteHeadBlockHash(batch, block.Hash())
+	rawdb.WriteChainConfig(batch, block.Hash(), config)
+	if err := batch.Write(); err != nil {
+		return nil, fmt.Errorf("failed to write genesis block: %w", err)
+	}
+	return block, nil
+}
+
+// MustCommit writes the genesis block and state to db, panicking on error.
+// The block is committed as the canonical head block.
+func (g *Genesis) MustCommit(db accdb.Database) *types.Block {
+	block, err := g.Commit(db)
+	if err != nil {
+		panic(err)
+	}
+	return block
+}
+
+// DefaultGenesisBlock returns the main-net genesis specification.
+func DefaultGenesisBlock() *Genesis {
+	return &Genesis{
+		Config:     params.MainnetChainConfig,
+		GasLimit:   GenesisGasLimit,
+		Difficulty: GenesisDifficulty,
+		ExtraData:  []byte("Genesis Block"),
+	}
+}
+
+// CreateGenesisBlock returns the main-net genesis block without persisting its
+// state anywhere.
+func CreateGenesisBlock() *types.Block {
+	return DefaultGenesisBlock().ToBlock(nil)
 }
@@ -0,0 +1,213 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+func TestGenesisJSON(t *testing.T) {
+	var (
+		slot    = common.HexToHash("0x01")
+		value   = common.HexToHash("0x2a")
+		genesis = &Genesis{
+			Config:     params.TestChainConfig,
+			Timestamp:  1600000000,
+			GasLimit:   8000000,
+			Difficulty: big.NewInt(2),
+			ExtraData:  []byte("test genesis"),
+			Alloc: GenesisAlloc{
+				testAddr: {Balance: big.NewInt(1000000000), Nonce: 3},
+				common.HexToAddress("0xc0de"): {
+					Code:    []byte{0x60, 0x00},
+					Storage: map[common.Hash]common.Hash{slot: value},
+					Balance: new(big.Int),
+				},
+			},
+		}
+	)
+	blob, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatalf("failed to encode genesis: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, blob, 0644); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	loaded, err := LoadGenesis(path)
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	if loaded.Config.ChainID.Cmp(genesis.Config.ChainID) != 0 {
+		t.Errorf("chain id mismatch: have %v, want %v", loaded.Config.ChainID, genesis.Config.ChainID)
+	}
+	// The loaded specification must produce the exact same genesis state
+	want := genesis.ToBlock(nil)
+	db := memorydb.New()
+	block := loaded.MustCommit(db)
+	if block.Hash() != want.Hash() || block.Root() != want.Root() {
+		t.Fatalf("genesis mismatch: have %x/%x, want %x/%x", block.Hash(), block.Root(), want.Hash(), want.Root())
+	}
+	bc, err := NewBlockChain(db, genesis.Config, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	if head := bc.CurrentBlock(); head == nil || head.Hash() != block.Hash() {
+		t.Fatalf("head mismatch: have %v, want %x", head, block.Hash())
+	}
+	statedb, err := bc.StateAt(block.Root())
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	if balance := statedb.GetBalance(testAddr); balance.Cmp(big.NewInt(1000000000)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %v", balance, 1000000000)
+	}
+	if nonce := statedb.GetNonce(testAddr); nonce != 3 {
+		t.Errorf("nonce mismatch: have %d, want %d", nonce, 3)
+	}
+	if have := statedb.GetState(common.HexToAddress("0xc0de"), slot); have != value {
+		t.Errorf("storage mismatch: have %x, want %x", have, value)
+	}
+}
+
+// hexGenesisJSON is a genesis file in the hex encoded format used by Ethereum
+// clients.
+const hexGenesisJSON = `{
+	"config": {"chainId": 1337, "homesteadBlock": 0, "eip155Block": 0, "eip158Block": 0},
+	"timestamp": "0x5f5e1000",
+	"gasLimit": "0x7a1200",
+	"difficulty": "0x20000",
+	"coinbase": "0x00000000000000000000000000000000000000c0",
+	"extraData": "0x6d792d636861696e",
+	"alloc": {
+		"0x71562b71999873db5b286df957af199ec94617f7": {
+			"balance": "0xde0b6b3a7640000",
+			"nonce": "0x3"
+		},
+		"0x000000000000000000000000000000000000c0de": {
+			"balance": "0x0",
+			"code": "0x6000",
+			"storage": {
+				"0x0000000000000000000000000000000000000000000000000000000000000001": "0x000000000000000000000000000000000000000000000000000000000000002a"
+			}
+		}
+	}
+}`
+
+func TestLoadHexGenesis(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, []byte(hexGenesisJSON), 0644); err != nil {
+		t.Fatalf("failed to write genesis: %v", err)
+	}
+	genesis, err := LoadGenesis(path)
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	if genesis.Timestamp != 1600000000 {
+		t.Errorf("timestamp mismatch: have %d, want %d", genesis.Timestamp, 1600000000)
+	}
+	if genesis.GasLimit != 8000000 {
+		t.Errorf("gas limit mismatch: have %d, want %d", genesis.GasLimit, 8000000)
+	}
+	if genesis.Difficulty.Cmp(big.NewInt(0x20000)) != 0 {
+		t.Errorf("difficulty mismatch: have %v, want %v", genesis.Difficulty, 0x20000)
+	}
+	if genesis.Coinbase != common.HexToAddress("0xc0") {
+		t.Errorf("coinbase mismatch: have %x", genesis.Coinbase)
+	}
+	if string(genesis.ExtraData) != "my-chain" {
+		t.Errorf("extra data mismatch: have %q, want %q", genesis.ExtraData, "my-chain")
+	}
+	if genesis.Config.ChainID.Cmp(big.NewInt(1337)) != 0 || !genesis.Config.IsEIP158(new(big.Int)) {
+		t.Errorf("config mismatch: have %v", genesis.Config)
+	}
+	funded := genesis.Alloc[common.HexToAddress("0x71562b71999873db5b286df957af199ec94617f7")]
+	if funded.Balance.Cmp(big.NewInt(1000000000000000000)) != 0 || funded.Nonce != 3 {
+		t.Errorf("funded account mismatch: balance %v, nonce %d", funded.Balance, funded.Nonce)
+	}
+	contract := genesis.Alloc[common.HexToAddress("0xc0de")]
+	if !bytes.Equal(contract.Code, []byte{0x60, 0x00}) || contract.Balance.Sign() != 0 {
+		t.Errorf("contract account mismatch: code %x, balance %v", contract.Code, contract.Balance)
+	}
+	if value := contract.Storage[common.HexToHash("0x01")]; value != common.HexToHash("0x2a") {
+		t.Errorf("contract storage mismatch: have %x", value)
+	}
+	// Re-encoding yields the same hex format and the same genesis block
+	blob, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatalf("failed to encode genesis: %v", err)
+	}
+	if !bytes.Contains(blob, []byte(`"gasLimit":"0x7a1200"`)) {
+		t.Errorf("gas limit not hex encoded: %s", blob)
+	}
+	reloaded := new(Genesis)
+	if err := json.Unmarshal(blob, reloaded); err != nil {
+		t.Fatalf("failed to decode genesis: %v", err)
+	}
+	if have, want := reloaded.ToBlock(nil).Hash(), genesis.ToBlock(nil).Hash(); have != want {
+		t.Errorf("genesis hash mismatch after round trip: have %x, want %x", have, want)
+	}
+	// Plain decimal quantities are not accepted
+	var invalid Genesis
+	if err := json.Unmarshal([]byte(`{"gasLimit": 8000000}`), &invalid); err == nil {
+		t.Error("decimal gas limit accepted")
+	}
+}
+
+func TestSetupGenesis(t *testing.T) {
+	db := memorydb.New()
+
+	// An empty database gets the default genesis
+	config, hash, err := SetupGenesisBlock(db, nil)
+	if err != nil {
+		t.Fatalf("failed to setup default genesis: %v", err)
+	}
+	if want := CreateGenesisBlock().Hash(); hash != want {
+		t.Errorf("default genesis hash mismatch: have %x, want %x", hash, want)
+	}
+	if config != params.MainnetChainConfig {
+		t.Errorf("default genesis config mismatch: have %v", config)
+	}
+	// Setting it up again without a genesis returns the stored one
+	if _, stored, err := SetupGenesisBlock(db, nil); err != nil || stored != hash {
+		t.Errorf("stored genesis mismatch: have %x (%v), want %x", stored, err, hash)
+	}
+	// A different genesis must be rejected
+	custom := DefaultGenesisBlock()
+	custom.Timestamp = 1
+	_, stored, err := SetupGenesisBlock(db, custom)
+
+	var mismatch *GenesisMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected genesis mismatch, have %v", err)
+	}
+	if stored != hash || mismatch.Stored != hash || mismatch.New != custom.ToBlock(nil).Hash() {
+		t.Errorf("mismatch error fields wrong: %v", mismatch)
+	}
+	// A genesis without chain configuration is rejected outright
+	custom.Config = nil
+	if _, _, err := SetupGenesisBlock(memorydb.New(), custom); err != errGenesisNoConfig {
+		t.Errorf("missing config error mismatch: have %v, want %v", err, errGenesisNoConfig)
+	}
+	// A configuration that schedules a fork before its predecessor is rejected
+	custom = DefaultGenesisBlock()
+	custom.Config = &params.ChainConfig{
+		ChainID:        big.NewInt(1337),
+		HomesteadBlock: big.NewInt(10),
+		EIP155Block:    big.NewInt(0),
+	}
+	if _, _, err := SetupGenesisBlock(memorydb.New(), custom); err == nil {
+		t.Error("misordered fork configuration accepted on a fresh database")
+	}
+	if _, _, err := SetupGenesisBlock(db, custom); err == nil {
+		t.Error("misordered fork configuration accepted on a stored genesis")
+	}
+}
@@ -0,0 +1,92 @@
+package chain
+
+import (
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-trie/common"
+)
+
+const (
+	// maxOrphanBlocks is the maximum number of blocks kept while waiting for
+	// their parents to arrive. The oldest orphan is evicted once it is reached.
+	maxOrphanBlocks = 256
+)
+
+// orphanPool is a bounded set of blocks whose parent is not yet known, keyed
+// by the hash of the missing parent so they can be connected once it arrives.
+// It is not safe for concurrent use; the chain mutex guards it.
+type orphanPool struct {
+	blocks  map[common.Hash]*types.Block   // Orphan blocks by their own hash
+	parents map[common.Hash][]*types.Block // Orphan blocks by missing parent hash
+	order   []common.Hash                  // Orphan hashes in arrival order, for eviction
+}
+
+func newOrphanPool() *orphanPool {
+	return &orphanPool{
+		blocks:  make(map[common.Hash]*types.Block),
+		parents: make(map[common.Hash][]*types.Block),
+	}
+}
+
+// add stores an orphan block, evicting the oldest one if the pool is full.
+func (p *orphanPool) add(block *types.Block) {
+	hash := block.Hash()
+	if _, ok := p.blocks[hash]; ok {
+		return
+	}
+	if len(p.order) >= maxOrphanBlocks {
+		p.remove(p.order[0])
+	}
+	p.blocks[hash] = block
+	p.parents[block.ParentHash()] = append(p.parents[block.ParentHash()], block)
+	p.order = append(p.order, hash)
+}
+
+// remove drops a single orphan block from the pool.
+func (p *orphanPool) remove(hash common.Hash) {
+	block, ok := p.blocks[hash]
+	if !ok {
+		return
+	}
+	delete(p.blocks, hash)
+
+	parent := block.ParentHash()
+	siblings := p.parents[parent]
+	for i, sibling := range siblings {
+		if sibling.Hash() == hash {
+			siblings = append(siblings[:i], siblings[i+1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(p.parents, parent)
+	} else {
+		p.parents[parent] = siblings
+	}
+
+	for i, h := range p.order {
+		if h == hash {
+			p.order = append(p.order[:i], p.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// take removes and returns all orphans waiting on the given parent hash.
+func (p *orphanPool) take(parent common.Hash) []*types.Block {
+	children := append([]*types.Block(nil), p.parents[parent]...)
+	for _, child := range children {
+		p.remove(child.Hash())
+	}
+	return children
+}
+
+// has reports whether a block is currently held as an orphan.
+func (p *orphanPool) has(hash common.Hash) bool {
+	_, ok := p.blocks[hash]
+	return ok
+}
+
+// len returns the number of orphan blocks held.
+func (p *orphanPool) len() int {
+	return len(p.blocks)
+}
@@ -1,7 +1,7 @@
 package chain
 
 import (
-	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/universe-30/mt-bc/chain/state"
 	"github.com/universe-30/mt-bc/chain/types"
 	"github.com/universe-30/mt-bc/consensus"
 	"github.com/universe-30/mt-trie/common"
@@ -15,6 +15,23 @@ type ChainContext interface {
 	GetHeader(common.Hash, uint64) *types.Header
 }
 
+// Validator is an interface which defines the standard for block validation.
+type Validator interface {
+	// ValidateHeader validates the given header against its parent.
+	ValidateHeader(header, parent *types.Header) error
+
+	// ValidateSanity validates the parts of the given block that do not depend
+	// on its parent.
+	ValidateSanity(block *types.Block) error
+
+	// ValidateBody validates the given block's content.
+	ValidateBody(block *types.Block) error
+
+	// ValidateState validates the given statedb, the receipts and the gas used
+	// produced by processing the block.
+	ValidateState(block *types.Block, state *state.StateDB, receipts []*types.Receipt, usedGas uint64) error
+}
+
 // Processor is an interface for processing blocks using a given initial state.
 type Processor interface {
 	Process(block *types.Block, statedb *state.StateDB) ([]*types.Receipt, uint64, error)
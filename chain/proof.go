@@ -0,0 +1,395 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/common/hexutil"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+	"github.com/universe-30/mt-trie/rlp"
+	"github.com/universe-30/mt-trie/trie"
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = common.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+
+	// emptyCodeHash is the known hash of the empty EVM bytecode.
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+var (
+	errUnknownBlock       = errors.New("unknown block")
+	errProofIndexTooLarge = errors.New("index out of range")
+)
+
+// ProofList is the list of trie nodes on the path from a trie root to a leaf.
+// It implements accdb.KeyValueWriter, collecting the nodes handed out by
+// trie.Prove in order.
+type ProofList [][]byte
+
+// Put appends a proof node to the list. The key, the node hash, is dropped as
+// it can be recomputed from the node itself.
+func (n *ProofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+// Delete is not supported on a proof.
+func (n *ProofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// database returns the proof nodes keyed by their hashes, the form in which
+// trie.VerifyProof expects them.
+func (n ProofList) database() *memorydb.Database {
+	db := memorydb.New()
+	for _, node := range n {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// InclusionProof proves that a transaction or a receipt sits at a given index
+// of a block. It carries the block header, so it can be checked against a
+// trusted header hash alone, and the trie nodes linking the header's
+// transaction or receipt root to the item.
+//
+// The RLP encoding of an InclusionProof is its compact serialization, as
+// produced by EncodeInclusionProof.
+type InclusionProof struct {
+	Header *types.Header
+	Index  uint64
+	Nodes  ProofList
+}
+
+// EncodeInclusionProof serializes the proof into its compact RLP form.
+func EncodeInclusionProof(proof *InclusionProof) ([]byte, error) {
+	return rlp.EncodeToBytes(proof)
+}
+
+// DecodeInclusionProof parses a proof serialized by EncodeInclusionProof.
+func DecodeInclusionProof(blob []byte) (*InclusionProof, error) {
+	proof := new(InclusionProof)
+	if err := rlp.DecodeBytes(blob, proof); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// GetTransactionProof creates a proof that the index'th transaction of the
+// block with the given hash is included in the block's TxHash.
+func (bc *BlockChain) GetTransactionProof(blockHash common.Hash, index uint64) (*InclusionProof, error) {
+	block := bc.GetBlockByHash(blockHash)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, blockHash)
+	}
+	return proveIndex(block.Header(), block.Header().TxHash, types.Transactions(block.Transactions()), index)
+}
+
+// GetReceiptProof creates a proof that the index'th receipt of the block with
+// the given hash is included in the block's ReceiptHash.
+func (bc *BlockChain) GetReceiptProof(blockHash common.Hash, index uint64) (*InclusionProof, error) {
+	header := bc.GetHeaderByHash(blockHash)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, blockHash)
+	}
+	return proveIndex(header, header.ReceiptHash, types.Receipts(bc.GetReceiptsByHash(blockHash)), index)
+}
+
+// proveIndex rebuilds the index keyed trie over list, the way DeriveSha hashes
+// it, and collects the proof for the index'th item. The rebuilt trie must hash
+// to root, the commitment in header.
+func proveIndex(header *types.Header, root common.Hash, list types.DerivableList, index uint64) (*InclusionProof, error) {
+	if index >= uint64(list.Len()) {
+		return nil, fmt.Errorf("%w: have %d, items %d", errProofIndexTooLarge, index, list.Len())
+	}
+	tr, err := trie.New(common.Hash{}, trie.NewDatabase(memorydb.New()))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i := 0; i < list.Len(); i++ {
+		buf.Reset()
+		list.EncodeIndex(i, &buf)
+		if err := tr.TryUpdate(rlp.AppendUint64(nil, uint64(i)), common.CopyBytes(buf.Bytes())); err != nil {
+			return nil, err
+		}
+	}
+	if hash := tr.Hash(); hash != root {
+		return nil, fmt.Errorf("%w: root mismatch: have %x, header %x", ErrInvalidProof, hash, root)
+	}
+	proof := &InclusionProof{Header: types.CopyHeader(header), Index: index}
+	if err := tr.Prove(rlp.AppendUint64(nil, index), 0, &proof.Nodes); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// VerifyTransactionProof checks the proof against the trusted hash of the
+// block header and returns the proven transaction.
+func VerifyTransactionProof(headerHash common.Hash, proof *InclusionProof) (*types.Transaction, error) {
+	blob, err := verifyInclusion(headerHash, proof, func(h *types.Header) common.Hash { return h.TxHash })
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(blob); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	return tx, nil
+}
+
+// VerifyReceiptProof checks the proof against the trusted hash of the block
+// header and returns the proven receipt. Only the consensus fields of the
+// receipt are restored.
+func VerifyReceiptProof(headerHash common.Hash, proof *InclusionProof) (*types.Receipt, error) {
+	blob, err := verifyInclusion(headerHash, proof, func(h *types.Header) common.Hash { return h.ReceiptHash })
+	if err != nil {
+		return nil, err
+	}
+	receipt := new(types.Receipt)
+	if err := receipt.UnmarshalBinary(blob); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	return receipt, nil
+}
+
+// verifyInclusion authenticates the proof's header against headerHash and
+// returns the value the proof nodes lead to from the root selected by root.
+func verifyInclusion(headerHash common.Hash, proof *InclusionProof, root func(*types.Header) common.Hash) ([]byte, error) {
+	if proof == nil || proof.Header == nil {
+		return nil, fmt.Errorf("%w: missing header", ErrInvalidProof)
+	}
+	if hash := proof.Header.Hash(); hash != headerHash {
+		return nil, fmt.Errorf("%w: header hash mismatch: have %x, want %x", ErrInvalidProof, hash, headerHash)
+	}
+	blob, err := trie.VerifyProof(root(proof.Header), rlp.AppendUint64(nil, proof.Index), proof.Nodes.database())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("%w: no item at index %d", ErrInvalidProof, proof.Index)
+	}
+	return blob, nil
+}
+
+// AccountResult is the Merkle proof of an account and a set of its storage
+// slots against the state root of a block, in the shape of eth_getProof.
+//
+// In JSON, the quantities and proof nodes are 0x-prefixed hex strings, as in
+// the eth_getProof responses of Ethereum clients.
+type AccountResult struct {
+	Address      common.Address  `json:"address"`
+	AccountProof ProofList       `json:"accountProof"`
+	Balance      *big.Int        `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        uint64          `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is the Merkle proof of a single storage slot against the
+// storage root of its account.
+type StorageResult struct {
+	Key   common.Hash `json:"key"`
+	Value common.Hash `json:"value"`
+	Proof ProofList   `json:"proof"`
+}
+
+// accountResultJSON is the JSON encoding of AccountResult.
+type accountResultJSON struct {
+	Address      common.Address  `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     common.Hash     `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  common.Hash     `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// MarshalJSON marshals as JSON.
+func (r AccountResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&accountResultJSON{
+		Address:      r.Address,
+		AccountProof: r.AccountProof.hex(),
+		Balance:      (*hexutil.Big)(r.Balance),
+		CodeHash:     r.CodeHash,
+		Nonce:        hexutil.Uint64(r.Nonce),
+		StorageHash:  r.StorageHash,
+		StorageProof: r.StorageProof,
+	})
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (r *AccountResult) UnmarshalJSON(input []byte) error {
+	var dec accountResultJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Balance == nil {
+		return errors.New("missing required field 'balance' for AccountResult")
+	}
+	r.Address = dec.Address
+	r.AccountProof = proofFromHex(dec.AccountProof)
+	r.Balance = (*big.Int)(dec.Balance)
+	r.CodeHash = dec.CodeHash
+	r.Nonce = uint64(dec.Nonce)
+	r.StorageHash = dec.StorageHash
+	r.StorageProof = dec.StorageProof
+	return nil
+}
+
+// storageResultJSON is the JSON encoding of StorageResult. The slot value is
+// a quantity, stripped of its leading zeros.
+type storageResultJSON struct {
+	Key   common.Hash     `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// MarshalJSON marshals as JSON.
+func (r StorageResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&storageResultJSON{
+		Key:   r.Key,
+		Value: (*hexutil.Big)(r.Value.Big()),
+		Proof: r.Proof.hex(),
+	})
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (r *StorageResult) UnmarshalJSON(input []byte) error {
+	var dec storageResultJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Value == nil {
+		return errors.New("missing required field 'value' for StorageResult")
+	}
+	r.Key = dec.Key
+	r.Value = common.BigToHash(dec.Value.ToInt())
+	r.Proof = proofFromHex(dec.Proof)
+	return nil
+}
+
+// hex returns the proof nodes in their JSON form.
+func (n ProofList) hex() []hexutil.Bytes {
+	nodes := make([]hexutil.Bytes, len(n))
+	for i, node := range n {
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// proofFromHex is the inverse of ProofList.hex.
+func proofFromHex(nodes []hexutil.Bytes) ProofList {
+	if nodes == nil {
+		return nil
+	}
+	proof := make(ProofList, len(nodes))
+	for i, node := range nodes {
+		proof[i] = node
+	}
+	return proof
+}
+
+// GetProof returns the account and storage values of the specified account
+// including the Merkle proofs, at the state of the block with the given hash.
+// Accounts that do not exist are proven absent and reported empty.
+func (bc *BlockChain) GetProof(address common.Address, storageKeys []common.Hash, blockHash common.Hash) (*AccountResult, error) {
+	header := bc.GetHeaderByHash(blockHash)
+	if header == nil {
+		return nil, fmt.Errorf("%w: %x", errUnknownBlock, blockHash)
+	}
+	statedb, err := bc.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	storageHash := emptyRoot
+	if storageTrie := statedb.StorageTrie(address); storageTrie != nil {
+		storageHash = storageTrie.Hash()
+	}
+	// Create the proofs for the storage keys
+	storageProof := make([]StorageResult, len(storageKeys))
+	for i, key := range storageKeys {
+		storageProof[i] = StorageResult{Key: key}
+		if storageHash == emptyRoot {
+			continue
+		}
+		proof, err := statedb.GetStorageProof(address, key)
+		if err != nil {
+			return nil, err
+		}
+		storageProof[i].Value = statedb.GetState(address, key)
+		storageProof[i].Proof = proof
+	}
+	// Create the account proof
+	accountProof, err := statedb.GetProof(address)
+	if err != nil {
+		return nil, err
+	}
+	codeHash := statedb.GetCodeHash(address)
+	if codeHash == (common.Hash{}) {
+		codeHash = emptyCodeHash
+	}
+	return &AccountResult{
+		Address:      address,
+		AccountProof: accountProof,
+		Balance:      statedb.GetBalance(address),
+		CodeHash:     codeHash,
+		Nonce:        statedb.GetNonce(address),
+		StorageHash:  storageHash,
+		StorageProof: storageProof,
+	}, statedb.Error()
+}
+
+// VerifyAccountProof checks the account and storage proofs of result against
+// the state root of the trusted header. It needs no access to the chain, so
+// account values handed out by an untrusted node can be audited with only
+// the header at hand.
+func VerifyAccountProof(header *types.Header, result *AccountResult) error {
+	if header == nil || result == nil {
+		return fmt.Errorf("%w: missing header or result", ErrInvalidProof)
+	}
+	blob, err := trie.VerifyProof(header.Root, crypto.Keccak256(result.Address.Bytes()), result.AccountProof.database())
+	if err != nil {
+		return fmt.Errorf("%w: account %x: %v", ErrInvalidProof, result.Address, err)
+	}
+	// A missing account must be reported empty, an existing one as stored
+	account := types.StateAccount{Balance: new(big.Int), Root: emptyRoot, CodeHash: emptyCodeHash.Bytes()}
+	if len(blob) > 0 {
+		if err := rlp.DecodeBytes(blob, &account); err != nil {
+			return fmt.Errorf("%w: account %x: %v", ErrInvalidProof, result.Address, err)
+		}
+	}
+	if result.Balance == nil || account.Balance.Cmp(result.Balance) != 0 || account.Nonce != result.Nonce ||
+		common.BytesToHash(account.CodeHash) != result.CodeHash || account.Root != result.StorageHash {
+		return fmt.Errorf("%w: account %x does not match its proof", ErrInvalidProof, result.Address)
+	}
+	for _, slot := range result.StorageProof {
+		var value common.Hash
+		if account.Root != emptyRoot {
+			blob, err := trie.VerifyProof(account.Root, crypto.Keccak256(slot.Key.Bytes()), slot.Proof.database())
+			if err != nil {
+				return fmt.Errorf("%w: slot %x: %v", ErrInvalidProof, slot.Key, err)
+			}
+			if len(blob) > 0 {
+				var content []byte
+				if err := rlp.DecodeBytes(blob, &content); err != nil {
+					return fmt.Errorf("%w: slot %x: %v", ErrInvalidProof, slot.Key, err)
+				}
+				value = common.BytesToHash(content)
+			}
+		}
+		if value != slot.Value {
+			return fmt.Errorf("%w: slot %x does not match its proof", ErrInvalidProof, slot.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+func TestInclusionProofs(t *testing.T) {
+	genesisBlock := CreateGenesisBlock()
+	bc := CreateNewBlockChain(genesisBlock)
+
+	block := createBlockWithData(bc, genesisBlock, "payment")
+	if err := bc.InsertBlock(block); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	// A transaction proof survives serialization and proves the transaction
+	proof, err := bc.GetTransactionProof(block.Hash(), 0)
+	if err != nil {
+		t.Fatalf("failed to create transaction proof: %v", err)
+	}
+	blob, err := EncodeInclusionProof(proof)
+	if err != nil {
+		t.Fatalf("failed to encode proof: %v", err)
+	}
+	if proof, err = DecodeInclusionProof(blob); err != nil {
+		t.Fatalf("failed to decode proof: %v", err)
+	}
+	tx, err := VerifyTransactionProof(block.Hash(), proof)
+	if err != nil {
+		t.Fatalf("failed to verify transaction proof: %v", err)
+	}
+	if tx.Hash() != block.Transactions()[0].Hash() {
+		t.Errorf("proven transaction mismatch: have %x, want %x", tx.Hash(), block.Transactions()[0].Hash())
+	}
+	// The proof is bound to its block
+	if _, err := VerifyTransactionProof(genesisBlock.Hash(), proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("foreign header error mismatch: have %v, want %v", err, ErrInvalidProof)
+	}
+	proof.Index = 1
+	if _, err := VerifyTransactionProof(block.Hash(), proof); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("wrong index error mismatch: have %v, want %v", err, ErrInvalidProof)
+	}
+	// A receipt proof proves the consensus fields of the receipt
+	proof, err = bc.GetReceiptProof(block.Hash(), 0)
+	if err != nil {
+		t.Fatalf("failed to create receipt proof: %v", err)
+	}
+	receipt, err := VerifyReceiptProof(block.Hash(), proof)
+	if err != nil {
+		t.Fatalf("failed to verify receipt proof: %v", err)
+	}
+	want := bc.GetReceiptsByHash(block.Hash())[0]
+	if receipt.Status != want.Status || receipt.CumulativeGasUsed != want.CumulativeGasUsed {
+		t.Errorf("proven receipt mismatch: have %+v, want %+v", receipt, want)
+	}
+	// Proofs are only handed out for existing items
+	if _, err := bc.GetTransactionProof(block.Hash(), 1); !errors.Is(err, errProofIndexTooLarge) {
+		t.Errorf("index error mismatch: have %v, want %v", err, errProofIndexTooLarge)
+	}
+	if _, err := bc.GetReceiptProof(common.Hash{1}, 0); !errors.Is(err, errUnknownBlock) {
+		t.Errorf("unknown block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
+
+func TestAccountProof(t *testing.T) {
+	var (
+		db       = memorydb.New()
+		contract = common.HexToAddress("0xc0de")
+		slot     = common.HexToHash("0x01")
+		value    = common.HexToHash("0x2a")
+		genesis  = &Genesis{
+			Config: testChainConfig,
+			Alloc: GenesisAlloc{
+				testAddr: {Balance: big.NewInt(1000000000), Nonce: 3},
+				contract: {
+					Code:    []byte{0x60, 0x00},
+					Storage: map[common.Hash]common.Hash{slot: value},
+				},
+			},
+		}
+	)
+	genesisBlock := genesis.MustCommit(db)
+	bc, err := NewBlockChain(db, testChainConfig, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	header := genesisBlock.Header()
+
+	// Plain accounts, contracts with storage and missing accounts all verify
+	for _, addr := range []common.Address{testAddr, contract, {0xff}} {
+		result, err := bc.GetProof(addr, []common.Hash{slot}, genesisBlock.Hash())
+		if err != nil {
+			t.Fatalf("%x: failed to create proof: %v", addr, err)
+		}
+		if err := VerifyAccountProof(header, result); err != nil {
+			t.Errorf("%x: failed to verify proof: %v", addr, err)
+		}
+	}
+	result, err := bc.GetProof(contract, []common.Hash{slot}, genesisBlock.Hash())
+	if err != nil {
+		t.Fatalf("failed to create proof: %v", err)
+	}
+	if result.StorageProof[0].Value != value {
+		t.Errorf("slot value mismatch: have %x, want %x", result.StorageProof[0].Value, value)
+	}
+	// Forged values are caught
+	result.StorageProof[0].Value = common.HexToHash("0x2b")
+	if err := VerifyAccountProof(header, result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("forged slot error mismatch: have %v, want %v", err, ErrInvalidProof)
+	}
+	result, _ = bc.GetProof(testAddr, nil, genesisBlock.Hash())
+	if result.Balance.Cmp(big.NewInt(1000000000)) != 0 || result.Nonce != 3 {
+		t.Errorf("account mismatch: have balance %v nonce %d", result.Balance, result.Nonce)
+	}
+	result.Balance = big.NewInt(2000000000)
+	if err := VerifyAccountProof(header, result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("forged balance error mismatch: have %v, want %v", err, ErrInvalidProof)
+	}
+	if err := VerifyAccountProof(nil, result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("missing header error mismatch: have %v, want %v", err, ErrInvalidProof)
+	}
+	if err := VerifyAccountProof(header, nil); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("missing result error mismatch: have %v, want %v", err, ErrInvalidProof)
+	}
+}
+
+func TestAccountProofJSON(t *testing.T) {
+	result := &AccountResult{
+		Address:      common.HexToAddress("0xc0de"),
+		AccountProof: ProofList{{0xf8, 0x01}, {0xe2}},
+		Balance:      big.NewInt(1000),
+		CodeHash:     emptyCodeHash,
+		Nonce:        3,
+		StorageHash:  emptyRoot,
+		StorageProof: []StorageResult{{
+			Key:   common.HexToHash("0x01"),
+			Value: common.HexToHash("0x2a"),
+			Proof: ProofList{{0xc2, 0x2a}},
+		}},
+	}
+	blob, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("failed to encode result: %v", err)
+	}
+	// Quantities and proof nodes are hex encoded as in eth_getProof
+	var fields struct {
+		AccountProof []string `json:"accountProof"`
+		Balance      string   `json:"balance"`
+		Nonce        string   `json:"nonce"`
+		StorageProof []struct {
+			Value string   `json:"value"`
+			Proof []string `json:"proof"`
+		} `json:"storageProof"`
+	}
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		t.Fatalf("failed to decode fields: %v", err)
+	}
+	if fields.Balance != "0x3e8" || fields.Nonce != "0x3" || fields.AccountProof[0] != "0xf801" ||
+		fields.StorageProof[0].Value != "0x2a" || fields.StorageProof[0].Proof[0] != "0xc22a" {
+		t.Errorf("unexpected encoding: %s", blob)
+	}
+	var dec AccountResult
+	if err := json.Unmarshal(blob, &dec); err != nil {
+		t.Fatalf("failed to decode result: %v", err)
+	}
+	if !reflect.DeepEqual(&dec, result) {
+		t.Errorf("round trip mismatch: have %+v, want %+v", dec, result)
+	}
+}
@@ -0,0 +1,215 @@
+package rawdb
+
+import (
+	"encoding/binary"
+	"log"
+	"math/big"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/rlp"
+)
+
+// ReadCanonicalHash retrieves the hash assigned to a canonical block number.
+func ReadCanonicalHash(db accdb.KeyValueReader, number uint64) common.Hash {
+	data, _ := db.Get(headerHashKey(number))
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteCanonicalHash stores the hash assigned to a canonical block number.
+func WriteCanonicalHash(db accdb.KeyValueWriter, hash common.Hash, number uint64) {
+	if err := db.Put(headerHashKey(number), hash.Bytes()); err != nil {
+		log.Fatalf("Failed to store number to hash mapping: %v", err)
+	}
+}
+
+// DeleteCanonicalHash removes the number to hash canonical mapping.
+func DeleteCanonicalHash(db accdb.KeyValueWriter, number uint64) {
+	if err := db.Delete(headerHashKey(number)); err != nil {
+		log.Fatalf("Failed to delete number to hash mapping: %v", err)
+	}
+}
+
+// ReadHeaderNumber returns the header number assigned to a hash.
+func ReadHeaderNumber(db accdb.KeyValueReader, hash common.Hash) *uint64 {
+	data, _ := db.Get(headerNumberKey(hash))
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteHeaderNumber stores the hash->number mapping.
+func WriteHeaderNumber(db accdb.KeyValueWriter, hash common.Hash, number uint64) {
+	key := headerNumberKey(hash)
+	enc := encodeBlockNumber(number)
+	if err := db.Put(key, enc); err != nil {
+		log.Fatalf("Failed to store hash to number mapping: %v", err)
+	}
+}
+
+// ReadHeadBlockHash retrieves the hash of the current canonical head block.
+func ReadHeadBlockHash(db accdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headBlockKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteHeadBlockHash stores the head block's hash.
+func WriteHeadBlockHash(db accdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Put(headBlockKey, hash.Bytes()); err != nil {
+		log.Fatalf("Failed to store last block's hash: %v", err)
+	}
+}
+
+// HasHeader verifies the existence of a block header corresponding to the hash.
+func HasHeader(db accdb.KeyValueReader, hash common.Hash, number uint64) bool {
+	if has, err := db.Has(headerKey(number, hash)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// ReadHeader retrieves the block header corresponding to the hash.
+func ReadHeader(db accdb.KeyValueReader, hash common.Hash, number uint64) *types.Header {
+	data, _ := db.Get(headerKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		log.Printf("Invalid block header RLP, hash %x: %v", hash, err)
+		return nil
+	}
+	return header
+}
+
+// WriteHeader stores a block header into the database and also stores the hash-
+// to-number mapping.
+func WriteHeader(db accdb.KeyValueWriter, hash common.Hash, header *types.Header) {
+	number := header.Number
+
+	// Write the hash -> number mapping
+	WriteHeaderNumber(db, hash, number)
+
+	// Write the encoded header
+	data, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		log.Fatalf("Failed to RLP encode header: %v", err)
+	}
+	if err := db.Put(headerKey(number, hash), data); err != nil {
+		log.Fatalf("Failed to store header: %v", err)
+	}
+}
+
+// HasBody verifies the existence of a block body corresponding to the hash.
+func HasBody(db accdb.KeyValueReader, hash common.Hash, number uint64) bool {
+	if has, err := db.Has(blockBodyKey(number, hash)); !has || err != nil {
+		return false
+	}
+	return true
+}
+
+// ReadBody retrieves the block body corresponding to the hash.
+func ReadBody(db accdb.KeyValueReader, hash common.Hash, number uint64) *types.Body {
+	data, _ := db.Get(blockBodyKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	body := new(types.Body)
+	if err := rlp.DecodeBytes(data, body); err != nil {
+		log.Printf("Invalid block body RLP, hash %x: %v", hash, err)
+		return nil
+	}
+	return body
+}
+
+// WriteBody stores a block body into the database.
+func WriteBody(db accdb.KeyValueWriter, hash common.Hash, number uint64, body *types.Body) {
+	data, err := rlp.EncodeToBytes(body)
+	if err != nil {
+		log.Fatalf("Failed to RLP encode body: %v", err)
+	}
+	if err := db.Put(blockBodyKey(number, hash), data); err != nil {
+		log.Fatalf("Failed to store block body: %v", err)
+	}
+}
+
+// ReadReceipts retrieves all the transaction receipts belonging to a block.
+func ReadReceipts(db accdb.KeyValueReader, hash common.Hash, number uint64) []*types.Receipt {
+	data, _ := db.Get(blockReceiptsKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var receipts []*types.Receipt
+	if err := rlp.DecodeBytes(data, &receipts); err != nil {
+		log.Printf("Invalid receipt array RLP, hash %x: %v", hash, err)
+		return nil
+	}
+	return receipts
+}
+
+// WriteReceipts stores all the transaction receipts belonging to a block.
+func WriteReceipts(db accdb.KeyValueWriter, hash common.Hash, number uint64, receipts []*types.Receipt) {
+	bytes, err := rlp.EncodeToBytes(receipts)
+	if err != nil {
+		log.Fatalf("Failed to encode block receipts: %v", err)
+	}
+	if err := db.Put(blockReceiptsKey(number, hash), bytes); err != nil {
+		log.Fatalf("Failed to store block receipts: %v", err)
+	}
+}
+
+// ReadTd retrieves a block's total difficulty corresponding to the hash.
+func ReadTd(db accdb.KeyValueReader, hash common.Hash, number uint64) *big.Int {
+	data, _ := db.Get(headerTDKey(number, hash))
+	if len(data) == 0 {
+		return nil
+	}
+	td := new(big.Int)
+	if err := rlp.DecodeBytes(data, td); err != nil {
+		log.Printf("Invalid block total difficulty RLP, hash %x: %v", hash, err)
+		return nil
+	}
+	return td
+}
+
+// WriteTd stores the total difficulty of a block into the database.
+func WriteTd(db accdb.KeyValueWriter, hash common.Hash, number uint64, td *big.Int) {
+	data, err := rlp.EncodeToBytes(td)
+	if err != nil {
+		log.Fatalf("Failed to RLP encode block total difficulty: %v", err)
+	}
+	if err := db.Put(headerTDKey(number, hash), data); err != nil {
+		log.Fatalf("Failed to store block total difficulty: %v", err)
+	}
+}
+
+// ReadBlock retrieves an entire block corresponding to the hash, assembling it
+// back from the stored header and body. If either the header or body could not
+// be retrieved nil is returned.
+func ReadBlock(db accdb.KeyValueReader, hash common.Hash, number uint64) *types.Block {
+	header := ReadHeader(db, hash, number)
+	if header == nil {
+		return nil
+	}
+	body := ReadBody(db, hash, number)
+	if body == nil {
+		return nil
+	}
+	return types.NewBlockWithHeader(header).WithBody(body.Transactions)
+}
+
+// WriteBlock serializes a block into the database, header and body separately.
+func WriteBlock(db accdb.KeyValueWriter, block *types.Block) {
+	hash := block.Hash()
+	WriteBody(db, hash, block.NumberU64(), block.Body())
+	WriteHeader(db, hash, block.Header())
+}
@@ -0,0 +1,38 @@
+package rawdb
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+// ReadChainConfig retrieves the consensus settings based on the given genesis hash.
+func ReadChainConfig(db accdb.KeyValueReader, hash common.Hash) *params.ChainConfig {
+	data, _ := db.Get(configKey(hash))
+	if len(data) == 0 {
+		return nil
+	}
+	var config params.ChainConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		log.Printf("Invalid chain config JSON, hash %x: %v", hash, err)
+		return nil
+	}
+	return &config
+}
+
+// WriteChainConfig writes the chain config settings to the database.
+func WriteChainConfig(db accdb.KeyValueWriter, hash common.Hash, cfg *params.ChainConfig) {
+	if cfg == nil {
+		return
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		log.Fatalf("Failed to JSON encode chain config: %v", err)
+	}
+	if err := db.Put(configKey(hash), data); err != nil {
+		log.Fatalf("Failed to store chain config: %v", err)
+	}
+}
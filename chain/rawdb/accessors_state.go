@@ -0,0 +1,28 @@
+package rawdb
+
+import (
+	"log"
+
+	"github.com/universe-30/mt-trie/accdb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+// ReadCode retrieves the contract code of the provided code hash.
+func ReadCode(db accdb.KeyValueReader, hash common.Hash) []byte {
+	data, _ := db.Get(codeKey(hash))
+	return data
+}
+
+// HasCode checks if the contract code corresponding to the
+// provided code hash is present in the db.
+func HasCode(db accdb.KeyValueReader, hash common.Hash) bool {
+	ok, _ := db.Has(codeKey(hash))
+	return ok
+}
+
+// WriteCode writes the provided contract code database.
+func WriteCode(db accdb.KeyValueWriter, hash common.Hash, code []byte) {
+	if err := db.Put(codeKey(hash), code); err != nil {
+		log.Fatalf("Failed to store contract code: %v", err)
+	}
+}
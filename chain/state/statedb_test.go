@@ -0,0 +1,171 @@
+package state
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+var (
+	testAddr  = common.BytesToAddress([]byte{0x01})
+	testAddr2 = common.BytesToAddress([]byte{0x02})
+	testKey   = common.BytesToHash([]byte{0x0a})
+	testVal   = common.BytesToHash([]byte{0x0b})
+	testVal2  = common.BytesToHash([]byte{0x0c})
+)
+
+func newTestState(t *testing.T) (*StateDB, Database) {
+	db := NewDatabase(memorydb.New())
+	statedb, err := New(common.Hash{}, db)
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	return statedb, db
+}
+
+// checkAccount fails the test if the account at addr does not hold the given
+// balance, nonce, storage value at testKey and code.
+func checkAccount(t *testing.T, s *StateDB, addr common.Address, balance int64, nonce uint64, value common.Hash, code []byte) {
+	t.Helper()
+	if have := s.GetBalance(addr); have.Cmp(big.NewInt(balance)) != 0 {
+		t.Errorf("balance mismatch: have %v, want %d", have, balance)
+	}
+	if have := s.GetNonce(addr); have != nonce {
+		t.Errorf("nonce mismatch: have %d, want %d", have, nonce)
+	}
+	if have := s.GetState(addr, testKey); have != value {
+		t.Errorf("storage mismatch: have %x, want %x", have, value)
+	}
+	if have := s.GetCode(addr); !bytes.Equal(have, code) {
+		t.Errorf("code mismatch: have %x, want %x", have, code)
+	}
+}
+
+func TestSnapshotRevert(t *testing.T) {
+	s, _ := newTestState(t)
+	s.SetBalance(testAddr, big.NewInt(10))
+	s.SetNonce(testAddr, 1)
+	s.SetState(testAddr, testKey, testVal)
+	s.SetCode(testAddr, []byte{0x60, 0x00})
+	s.AddRefund(5)
+
+	snap := s.Snapshot()
+	s.AddBalance(testAddr, big.NewInt(32))
+	s.SetNonce(testAddr, 2)
+	s.SetState(testAddr, testKey, testVal2)
+	s.SetCode(testAddr, []byte{0x60, 0x01})
+	s.AddRefund(7)
+	s.SetBalance(testAddr2, big.NewInt(1))
+
+	checkAccount(t, s, testAddr, 42, 2, testVal2, []byte{0x60, 0x01})
+	if refund := s.GetRefund(); refund != 12 {
+		t.Errorf("refund mismatch: have %d, want 12", refund)
+	}
+	s.RevertToSnapshot(snap)
+
+	checkAccount(t, s, testAddr, 10, 1, testVal, []byte{0x60, 0x00})
+	if refund := s.GetRefund(); refund != 5 {
+		t.Errorf("refund mismatch after revert: have %d, want 5", refund)
+	}
+	if s.ExistAccount(testAddr2) {
+		t.Error("account created after the snapshot survived the revert")
+	}
+}
+
+func TestNestedSnapshotRevert(t *testing.T) {
+	s, _ := newTestState(t)
+	s.SetBalance(testAddr, big.NewInt(1))
+
+	outer := s.Snapshot()
+	s.SetBalance(testAddr, big.NewInt(2))
+	s.SetState(testAddr, testKey, testVal)
+
+	inner := s.Snapshot()
+	s.SetBalance(testAddr, big.NewInt(3))
+	s.SetState(testAddr, testKey, testVal2)
+
+	// Reverting the outer snapshot must undo the changes after the inner one too
+	s.RevertToSnapshot(outer)
+	checkAccount(t, s, testAddr, 1, 0, common.Hash{}, nil)
+
+	// The inner snapshot was invalidated by reverting past it
+	defer func() {
+		if recover() == nil {
+			t.Error("reverting to an invalidated snapshot did not panic")
+		}
+	}()
+	s.RevertToSnapshot(inner)
+}
+
+func TestIntermediateRootCommit(t *testing.T) {
+	s, db := newTestState(t)
+	s.SetBalance(testAddr, big.NewInt(42))
+	s.SetNonce(testAddr, 3)
+	s.SetState(testAddr, testKey, testVal)
+	s.SetCode(testAddr, []byte{0x60, 0x00})
+
+	intermediate := s.IntermediateRoot(false)
+	root, err := s.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if root != intermediate {
+		t.Fatalf("root mismatch: intermediate %x, committed %x", intermediate, root)
+	}
+	if err := db.TrieDB().Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to flush trie: %v", err)
+	}
+	// Reopen the committed root and check it carries the same state and root
+	reloaded, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to reopen state: %v", err)
+	}
+	checkAccount(t, reloaded, testAddr, 42, 3, testVal, []byte{0x60, 0x00})
+	if have := reloaded.IntermediateRoot(false); have != root {
+		t.Fatalf("reopened root mismatch: have %x, want %x", have, root)
+	}
+	if have, err := reloaded.Commit(false); err != nil || have != root {
+		t.Fatalf("recommitted root mismatch: have %x, want %x (err %v)", have, root, err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	orig, _ := newTestState(t)
+	orig.SetBalance(testAddr, big.NewInt(1))
+	orig.SetState(testAddr, testKey, testVal)
+	orig.Finalise(false)
+
+	copied := orig.Copy()
+	orig.SetBalance(testAddr, big.NewInt(2))
+	orig.SetState(testAddr, testKey, testVal2)
+	copied.SetBalance(testAddr, big.NewInt(3))
+
+	checkAccount(t, orig, testAddr, 2, 0, testVal2, nil)
+	checkAccount(t, copied, testAddr, 3, 0, testVal, nil)
+
+	if orig.IntermediateRoot(false) == copied.IntermediateRoot(false) {
+		t.Fatal("diverged states share a root")
+	}
+}
+
+func TestAccessListRevert(t *testing.T) {
+	s, _ := newTestState(t)
+	s.PrepareAccessList(testAddr, nil, nil)
+
+	snap := s.Snapshot()
+	s.AddSlotToAccessList(testAddr2, testKey)
+	if addrOk, slotOk := s.SlotInAccessList(testAddr2, testKey); !addrOk || !slotOk {
+		t.Fatalf("slot missing from access list: address %v, slot %v", addrOk, slotOk)
+	}
+	s.RevertToSnapshot(snap)
+
+	if s.AddressInAccessList(testAddr2) {
+		t.Error("address added after the snapshot survived the revert")
+	}
+	if !s.AddressInAccessList(testAddr) {
+		t.Error("prepared address lost in the revert")
+	}
+}
@@ -2,15 +2,15 @@ package chain
 
 import (
 	"fmt"
+	"math/big"
 
-	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/universe-30/mt-bc/chain/state"
 	"github.com/universe-30/mt-bc/chain/types"
 	"github.com/universe-30/mt-bc/chain/vm"
+	"github.com/universe-30/mt-bc/params"
 	"github.com/universe-30/mt-trie/common"
 )
 
-var TestTxOwner = common.Address{1}
-
 type StateProcessor struct {
 	bc *BlockChain
 }
@@ -31,28 +31,47 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB) ([]
 		gp          = new(GasPool).AddGas(block.GasLimit())
 	)
 
-	blockContext := NewEVMBlockContext(header, nil)
-	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb)
+	blockContext := NewEVMBlockContext(header, p.bc, nil)
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, p.bc.chainConfig)
+	signer := types.MakeSigner(p.bc.chainConfig, blockContext.BlockNumber)
 	// Iterate over and process the individual transactions
 	for i, tx := range block.Transactions() {
-		msg, err := tx.AsMessage(&TestTxOwner)
+		msg, err := tx.AsMessage(signer, header.BaseFee)
 		if err != nil {
 			return nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
 		statedb.Prepare(tx.Hash(), i)
-		receipt, err := applyTransaction(msg, nil, gp, statedb, blockNumber, blockHash, tx, usedGas, vmenv)
+		receipt, err := applyTransaction(msg, p.bc.chainConfig, nil, gp, statedb, blockNumber, blockHash, tx, usedGas, vmenv)
 		if err != nil {
 			return nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
 		receipts = append(receipts, receipt)
 	}
-
-	header.Root = statedb.IntermediateRoot(true)
+	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
+	if engine := p.bc.Engine(); engine != nil {
+		engine.Finalize(p.bc, header, statedb, block.Transactions())
+	}
 
 	return receipts, *usedGas, nil
 }
 
-func applyTransaction(msg Message, author *common.Address, gp *GasPool, statedb *state.StateDB, blockNumber uint64, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, error) {
+// ApplyTransaction attempts to apply a transaction to the given state database
+// and uses the input parameters for its environment. It returns the receipt
+// for the transaction and an error if the transaction failed, indicating the
+// block was invalid. The receipt's block hash is left empty, since it is only
+// known once the block carrying the transaction is sealed.
+func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *common.Address, gp *GasPool, statedb *state.StateDB, header *types.Header, tx *types.Transaction, usedGas *uint64) (*types.Receipt, error) {
+	msg, err := tx.AsMessage(types.MakeSigner(config, new(big.Int).SetUint64(header.Number)), header.BaseFee)
+	if err != nil {
+		return nil, err
+	}
+	// Create a new context to be used in the EVM environment
+	blockContext := NewEVMBlockContext(header, bc, author)
+	vmenv := vm.NewEVM(blockContext, vm.TxContext{}, statedb, config)
+	return applyTransaction(msg, config, author, gp, statedb, header.Number, common.Hash{}, tx, usedGas, vmenv)
+}
+
+func applyTransaction(msg Message, config *params.ChainConfig, author *common.Address, gp *GasPool, statedb *state.StateDB, blockNumber uint64, blockHash common.Hash, tx *types.Transaction, usedGas *uint64, evm *vm.EVM) (*types.Receipt, error) {
 
 	// Create a new context to be used in the EVM environment.
 	txContext := NewEVMTxContext(msg)
@@ -64,14 +83,15 @@ func applyTransaction(msg Message, author *common.Address, gp *GasPool, statedb
 		return nil, err
 	}
 
-	// Update the state with pending changes.
-	root := statedb.IntermediateRoot(true).Bytes()
+	// Update the state with pending changes, clearing touched empty accounts
+	// once EIP-158 is active.
+	root := statedb.IntermediateRoot(config.IsEIP158(evm.Context.BlockNumber)).Bytes()
 
 	*usedGas += result.UsedGas
 
 	// Create a new receipt for the transaction, storing the intermediate root and gas used
 	// by the tx.
-	receipt := &types.Receipt{PostHash: root, CumulativeGasUsed: *usedGas}
+	receipt := &types.Receipt{Type: tx.Type(), PostHash: root, CumulativeGasUsed: *usedGas}
 	if result.Failed() {
 		receipt.Status = types.ReceiptStatusFailed
 	} else {
@@ -86,7 +106,8 @@ func applyTransaction(msg Message, author *common.Address, gp *GasPool, statedb
 	}
 
 	// Set the receipt logs and create the bloom filter.
-	// receipt.Logs = statedb.GetLogs(tx.Hash(), blockHash)
+	receipt.Logs = statedb.GetLogs(tx.Hash(), blockHash)
+	receipt.Bloom = types.CreateBloom([]*types.Receipt{receipt})
 	receipt.BlockHash = blockHash
 	receipt.BlockNumber = blockNumber
 	receipt.TransactionIndex = uint(statedb.TxIndex())
@@ -0,0 +1,62 @@
+package chain
+
+import (
+	"testing"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+func TestProcessReceiptLogs(t *testing.T) {
+	var (
+		db       = memorydb.New()
+		contract = common.HexToAddress("0xc0de")
+		topic    = common.HexToHash("0x01")
+		// PUSH1 0x01 PUSH1 0x20 PUSH1 0x00 LOG1 STOP
+		code    = []byte{0x60, 0x01, 0x60, 0x20, 0x60, 0x00, 0xa1, 0x00}
+		genesis = &Genesis{
+			Config: testChainConfig,
+			Alloc:  GenesisAlloc{contract: {Code: code}},
+		}
+	)
+	genesisBlock := genesis.MustCommit(db)
+	bc, err := NewBlockChain(db, testChainConfig, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	tx := types.MustSignNewTx(testKey, testSigner, &types.LegacyTx{
+		Gas: 100000,
+		To:  &contract,
+	})
+	block := types.CreateNewBlock(genesisBlock, []*types.Transaction{tx})
+
+	statedb, err := bc.StateAt(genesisBlock.Root())
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	receipts, _, err := bc.processor.Process(block, statedb)
+	if err != nil {
+		t.Fatalf("failed to process block: %v", err)
+	}
+	logs := receipts[0].Logs
+	if len(logs) != 1 {
+		t.Fatalf("log count mismatch: have %d, want 1", len(logs))
+	}
+	if logs[0].Address != contract || len(logs[0].Topics) != 1 || logs[0].Topics[0] != topic {
+		t.Errorf("log mismatch: have %x %x", logs[0].Address, logs[0].Topics)
+	}
+	if logs[0].TxHash != tx.Hash() || logs[0].BlockHash != block.Hash() {
+		t.Errorf("log position mismatch: have tx %x block %x", logs[0].TxHash, logs[0].BlockHash)
+	}
+	bloom := types.CreateBloom(receipts)
+	if receipts[0].Bloom != bloom {
+		t.Errorf("receipt bloom mismatch")
+	}
+	if !types.BloomLookup(bloom, contract) || !types.BloomLookup(bloom, topic) {
+		t.Errorf("bloom misses the log address or topic")
+	}
+	if types.BloomLookup(bloom, common.HexToHash("0x02")) {
+		t.Errorf("bloom matches an unrelated topic")
+	}
+}
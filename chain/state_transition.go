@@ -2,9 +2,10 @@ package chain
 
 import (
 	"fmt"
+	"math"
 	"math/big"
 
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/universe-30/mt-bc/chain/types"
 	"github.com/universe-30/mt-bc/chain/vm"
 	"github.com/universe-30/mt-trie/common"
 )
@@ -14,6 +15,8 @@ type StateTransition struct {
 	msg        Message
 	gas        uint64
 	gasPrice   *big.Int
+	gasFeeCap  *big.Int
+	gasTipCap  *big.Int
 	initialGas uint64
 	value      *big.Int
 	data       []byte
@@ -27,12 +30,15 @@ type Message interface {
 	To() *common.Address
 
 	GasPrice() *big.Int
+	GasFeeCap() *big.Int
+	GasTipCap() *big.Int
 	Gas() uint64
 	Value() *big.Int
 
 	Nonce() uint64
 	// IsFake() bool
 	Data() []byte
+	AccessList() types.AccessList
 }
 
 // ExecutionResult includes all output after executing given evm
@@ -46,16 +52,59 @@ type ExecutionResult struct {
 
 func (result *ExecutionResult) Failed() bool { return result.Err != nil }
 
+// IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
+func IntrinsicGas(data []byte, accessList types.AccessList, isContractCreation bool, isHomestead, isEIP2028 bool) (uint64, error) {
+	// Set the starting gas for the raw transaction
+	var gas uint64
+	if isContractCreation && isHomestead {
+		gas = vm.TxGasContractCreation
+	} else {
+		gas = vm.TxGas
+	}
+	// Bump the required gas by the amount of transactional data
+	if len(data) > 0 {
+		// Zero and non-zero bytes are priced differently
+		var nz uint64
+		for _, byt := range data {
+			if byt != 0 {
+				nz++
+			}
+		}
+		// Make sure we don't exceed uint64 for all data combinations
+		nonZeroGas := vm.TxDataNonZeroGasFrontier
+		if isEIP2028 {
+			nonZeroGas = vm.TxDataNonZeroGasEIP2028
+		}
+		if (math.MaxUint64-gas)/nonZeroGas < nz {
+			return 0, ErrGasUintOverflow
+		}
+		gas += nz * nonZeroGas
+
+		z := uint64(len(data)) - nz
+		if (math.MaxUint64-gas)/vm.TxDataZeroGas < z {
+			return 0, ErrGasUintOverflow
+		}
+		gas += z * vm.TxDataZeroGas
+	}
+	if accessList != nil {
+		gas += uint64(len(accessList)) * vm.TxAccessListAddressGas
+		gas += uint64(accessList.StorageKeys()) * vm.TxAccessListStorageKeyGas
+	}
+	return gas, nil
+}
+
 // NewStateTransition initialises and returns a new state transition object.
 func NewStateTransition(evm *vm.EVM, msg Message, gp *GasPool) *StateTransition {
 	return &StateTransition{
-		gp:       gp,
-		evm:      evm,
-		msg:      msg,
-		gasPrice: msg.GasPrice(),
-		value:    msg.Value(),
-		data:     msg.Data(),
-		state:    evm.StateDB,
+		gp:        gp,
+		evm:       evm,
+		msg:       msg,
+		gasPrice:  msg.GasPrice(),
+		gasFeeCap: msg.GasFeeCap(),
+		gasTipCap: msg.GasTipCap(),
+		value:     msg.Value(),
+		data:      msg.Data(),
+		state:     evm.StateDB,
 	}
 }
 
@@ -94,10 +143,29 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 		statedb          = st.state
 		msg              = st.msg
 		sender           = vm.AccountRef(msg.From())
+		rules            = st.evm.ChainConfig().Rules(st.evm.Context.BlockNumber)
 		contractCreation = msg.To() == nil
 	)
 
+	// Check clauses 4-5, subtract intrinsic gas if everything is correct
+	gas, err := IntrinsicGas(st.data, msg.AccessList(), contractCreation, rules.IsHomestead, rules.IsIstanbul)
+	if err != nil {
+		return nil, err
+	}
+	if st.gas < gas {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, st.gas, gas)
+	}
+	st.gas -= gas
+
+	// Check clause 6
+	if msg.Value().Sign() > 0 && !vm.CanTransfer(statedb, msg.From(), msg.Value()) {
+		return nil, fmt.Errorf("%w: address %v", ErrInsufficientFundsForTransfer, msg.From().Hex())
+	}
+
 	// Set up the initial access list.
+	if rules.IsBerlin {
+		statedb.PrepareAccessList(msg.From(), msg.To(), msg.AccessList())
+	}
 	var (
 		ret          []byte
 		vmerr        error // vm errors do not effect consensus and are therefore not assigned to err
@@ -105,20 +173,34 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 	)
 
 	if contractCreation {
-		nonce := statedb.GetNonce(sender.Address())
-		*contractAddr = crypto.CreateAddress(sender.Address(), nonce)
-		ret, st.gas, vmerr = st.evm.Create(*contractAddr, sender, st.data, st.gas, st.value)
+		var addr common.Address
+		ret, addr, st.gas, vmerr = st.evm.Create(sender, st.data, st.gas, st.value)
+		contractAddr = &addr
 	} else {
 		// Increment the nonce for the next transaction
 		nonce := statedb.GetNonce(sender.Address())
 		statedb.SetNonce(sender.Address(), nonce+1)
 		ret, st.gas, vmerr = st.evm.Call(sender, st.to(), st.data, st.gas, st.value)
 	}
+	if rules.IsLondon {
+		// After EIP-3529: refunds are capped to gasUsed / 5
+		st.refundGas(vm.RefundQuotientEIP3529)
+	} else {
+		// Before EIP-3529: refunds were capped to gasUsed / 2
+		st.refundGas(vm.RefundQuotient)
+	}
 
 	gasUsed := st.gasUsed()
 
-	// Base Fee
+	// The coinbase only earns the tip; under EIP-1559 the base fee part of the
+	// price is burnt.
 	effectiveTip := st.gasPrice
+	if rules.IsLondon {
+		effectiveTip = new(big.Int).Sub(st.gasFeeCap, st.evm.Context.BaseFee)
+		if effectiveTip.Cmp(st.gasTipCap) > 0 {
+			effectiveTip = st.gasTipCap
+		}
+	}
 	fee := new(big.Int).SetUint64(gasUsed)
 	fee.Mul(fee, effectiveTip)
 	statedb.AddBalance(st.evm.Context.Coinbase, fee)
@@ -131,8 +213,49 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 	}, nil
 }
 
+// preCheck checks the message against the sender account and the block before
+// any gas is bought: the nonce must be the sender's next one, the sender must
+// not be a contract and, from London on, the fee cap must cover the base fee.
 func (st *StateTransition) preCheck() error {
-
+	// Make sure this transaction's nonce is correct.
+	from := st.msg.From()
+	stNonce := st.state.GetNonce(from)
+	if msgNonce := st.msg.Nonce(); stNonce < msgNonce {
+		return fmt.Errorf("%w: address %v, tx: %d state: %d", ErrNonceTooHigh,
+			from.Hex(), msgNonce, stNonce)
+	} else if stNonce > msgNonce {
+		return fmt.Errorf("%w: address %v, tx: %d state: %d", ErrNonceTooLow,
+			from.Hex(), msgNonce, stNonce)
+	} else if stNonce+1 < stNonce {
+		return fmt.Errorf("%w: address %v, nonce: %d", ErrNonceMax,
+			from.Hex(), stNonce)
+	}
+	// Make sure the sender is an EOA
+	if codeHash := st.state.GetCodeHash(from); codeHash != emptyCodeHash && codeHash != (common.Hash{}) {
+		return fmt.Errorf("%w: address %v, codehash: %s", ErrSenderNoEOA,
+			from.Hex(), codeHash)
+	}
+	// Make sure that transaction gasFeeCap is greater than the baseFee (post london)
+	if st.evm.ChainConfig().IsLondon(st.evm.Context.BlockNumber) {
+		if l := st.gasFeeCap.BitLen(); l > 256 {
+			return fmt.Errorf("%w: address %v, maxFeePerGas bit length: %d", ErrFeeCapVeryHigh,
+				from.Hex(), l)
+		}
+		if l := st.gasTipCap.BitLen(); l > 256 {
+			return fmt.Errorf("%w: address %v, maxPriorityFeePerGas bit length: %d", ErrTipVeryHigh,
+				from.Hex(), l)
+		}
+		if st.gasFeeCap.Cmp(st.gasTipCap) < 0 {
+			return fmt.Errorf("%w: address %v, maxPriorityFeePerGas: %s, maxFeePerGas: %s", ErrTipAboveFeeCap,
+				from.Hex(), st.gasTipCap, st.gasFeeCap)
+		}
+		// This will panic if baseFee is nil, but basefee presence is verified
+		// as part of header validation.
+		if st.gasFeeCap.Cmp(st.evm.Context.BaseFee) < 0 {
+			return fmt.Errorf("%w: address %v, maxFeePerGas: %s baseFee: %s", ErrFeeCapTooLow,
+				from.Hex(), st.gasFeeCap, st.evm.Context.BaseFee)
+		}
+	}
 	return nil
 }
 
@@ -144,6 +267,13 @@ func (st *StateTransition) buyGas() error {
 	mgval := new(big.Int).SetUint64(msgGas)
 	mgval = mgval.Mul(mgval, st.gasPrice)
 	balanceCheck := mgval
+	if st.gasFeeCap != nil {
+		// The sender must be able to afford the worst case price, not only
+		// the effective one.
+		balanceCheck = new(big.Int).SetUint64(msgGas)
+		balanceCheck = balanceCheck.Mul(balanceCheck, st.gasFeeCap)
+		balanceCheck.Add(balanceCheck, st.value)
+	}
 
 	if have, want := statedb.GetBalance(msg.From()), balanceCheck; have.Cmp(want) < 0 {
 		return fmt.Errorf("%w: address %v have %v want %v", ErrInsufficientFunds, msg.From().Hex(), have, want)
@@ -158,6 +288,23 @@ func (st *StateTransition) buyGas() error {
 	return nil
 }
 
+func (st *StateTransition) refundGas(refundQuotient uint64) {
+	// Apply refund counter, capped to a refund quotient
+	refund := st.gasUsed() / refundQuotient
+	if refund > st.state.GetRefund() {
+		refund = st.state.GetRefund()
+	}
+	st.gas += refund
+
+	// Return ETH for remaining gas, exchanged at the original rate.
+	remaining := new(big.Int).Mul(new(big.Int).SetUint64(st.gas), st.gasPrice)
+	st.state.AddBalance(st.msg.From(), remaining)
+
+	// Also return remaining gas to the block gas counter so it is
+	// available for the next transaction.
+	st.gp.AddGas(st.gas)
+}
+
 // gasUsed returns the amount of gas used up by the state transition.
 func (st *StateTransition) gasUsed() uint64 {
 	return st.initialGas - st.gas
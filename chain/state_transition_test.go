@@ -0,0 +1,121 @@
+package chain
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/chain/vm"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+)
+
+func TestStateTransitionPreCheck(t *testing.T) {
+	var (
+		config     = params.TestChainConfig
+		signer     = types.LatestSigner(config)
+		codeKey, _ = crypto.GenerateKey()
+		codeAddr   = crypto.PubkeyToAddress(codeKey.PublicKey)
+		header     = &types.Header{
+			Number:   1,
+			GasLimit: GenesisGasLimit,
+			BaseFee:  new(big.Int).SetUint64(InitialBaseFee),
+		}
+		price = new(big.Int).SetUint64(InitialBaseFee)
+	)
+	legacy := func(nonce uint64, gas uint64, gasPrice *big.Int) *types.Transaction {
+		return types.MustSignNewTx(testKey, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			GasPrice: gasPrice,
+			Gas:      gas,
+			To:       &common.Address{},
+		})
+	}
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+		err  error
+	}{
+		{"nonce too low", legacy(0, 21000, price), ErrNonceTooLow},
+		{"nonce too high", legacy(2, 21000, price), ErrNonceTooHigh},
+		{"intrinsic gas", legacy(1, 20999, price), ErrIntrinsicGas},
+		{"fee cap below base fee", legacy(1, 21000, new(big.Int).SetUint64(InitialBaseFee-1)), ErrFeeCapTooLow},
+		{"sender has code", types.MustSignNewTx(codeKey, signer, &types.LegacyTx{
+			GasPrice: price,
+			Gas:      21000,
+			To:       &common.Address{},
+		}), ErrSenderNoEOA},
+		{"valid", legacy(1, 21000, price), nil},
+	}
+	for _, tt := range tests {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+		statedb.SetBalance(testAddr, big.NewInt(1000000000000000000))
+		statedb.SetNonce(testAddr, 1)
+		statedb.SetBalance(codeAddr, big.NewInt(1000000000000000000))
+		statedb.SetCode(codeAddr, []byte{0x00})
+
+		var usedGas uint64
+		gp := new(GasPool).AddGas(header.GasLimit)
+		_, err := ApplyTransaction(config, nil, &common.Address{}, gp, statedb, header, tt.tx, &usedGas)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+		if err == nil && usedGas != 21000 {
+			t.Errorf("%s: gas used mismatch: have %d, want %d", tt.name, usedGas, 21000)
+		}
+	}
+}
+
+func TestStateTransitionRefund(t *testing.T) {
+	var (
+		contract = common.Address{0xcc}
+		slot     = common.Hash{}
+		// Clear storage slot 0, which is set before the transaction
+		code = []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.STOP)}
+	)
+	berlin := *params.TestChainConfig
+	berlin.LondonBlock = nil
+
+	// Intrinsic gas, two pushes, a cold slot access and the write to it
+	execGas := vm.TxGas + 2*vm.GasFastestStep + vm.ColdSloadCostEIP2929 + (vm.SstoreResetGasEIP2200 - vm.ColdSloadCostEIP2929)
+	tests := []struct {
+		name    string
+		config  *params.ChainConfig
+		baseFee *big.Int
+		used    uint64
+	}{
+		// The EIP-2200 refund is capped at half the gas used
+		{"berlin", &berlin, nil, execGas - execGas/vm.RefundQuotient},
+		// EIP-3529 cuts the refund, which falls below the cap of a fifth
+		{"london", params.TestChainConfig, new(big.Int).SetUint64(InitialBaseFee), execGas - vm.SstoreClearsScheduleRefundEIP3529},
+	}
+	for _, tt := range tests {
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+		statedb.SetBalance(testAddr, big.NewInt(1000000000000000000))
+		statedb.SetCode(contract, code)
+		statedb.SetState(contract, slot, common.Hash{0x01})
+		statedb.IntermediateRoot(false)
+
+		header := &types.Header{Number: 1, GasLimit: GenesisGasLimit, BaseFee: tt.baseFee}
+		tx := types.MustSignNewTx(testKey, types.LatestSigner(tt.config), &types.LegacyTx{
+			GasPrice: new(big.Int).SetUint64(InitialBaseFee),
+			Gas:      100000,
+			To:       &contract,
+		})
+		var usedGas uint64
+		gp := new(GasPool).AddGas(header.GasLimit)
+		if _, err := ApplyTransaction(tt.config, nil, &common.Address{}, gp, statedb, header, tx, &usedGas); err != nil {
+			t.Fatalf("%s: failed to apply transaction: %v", tt.name, err)
+		}
+		if usedGas != tt.used {
+			t.Errorf("%s: gas used mismatch: have %d, want %d", tt.name, usedGas, tt.used)
+		}
+		if value := statedb.GetState(contract, slot); value != (common.Hash{}) {
+			t.Errorf("%s: slot not cleared: have %x", tt.name, value)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package txpool
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/universe-30/mt-bc/chain"
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = crypto.PubkeyToAddress(testKey.PublicKey)
+	testSigner = types.LatestSigner(params.TestChainConfig)
+)
+
+// testBlockChain is a minimal chain serving a set of known blocks on top of a
+// single mutable state, which is all the pool needs for validation. Head
+// changes are announced to the subscribers like the real chain does.
+type testBlockChain struct {
+	mu      sync.Mutex
+	head    *types.Block
+	blocks  map[common.Hash]*types.Block
+	statedb *state.StateDB
+	feed    []chan<- chain.ChainHeadEvent
+}
+
+func newTestBlockChain(gasLimit uint64) *testBlockChain {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	head := types.NewBlockWithHeader(&types.Header{GasLimit: gasLimit})
+	return &testBlockChain{
+		head:    head,
+		blocks:  map[common.Hash]*types.Block{head.Hash(): head},
+		statedb: statedb,
+	}
+}
+
+func (bc *testBlockChain) CurrentBlock() *types.Block {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.head
+}
+
+func (bc *testBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	if block := bc.blocks[hash]; block != nil && block.NumberU64() == number {
+		return block
+	}
+	return nil
+}
+
+func (bc *testBlockChain) StateAt(common.Hash) (*state.StateDB, error) { return bc.statedb, nil }
+
+func (bc *testBlockChain) SubscribeChainHeadEvent(ch chan<- chain.ChainHeadEvent) func() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.feed = append(bc.feed, ch)
+	return func() {
+		bc.mu.Lock()
+		defer bc.mu.Unlock()
+		for i, sub := range bc.feed {
+			if sub == ch {
+				bc.feed = append(bc.feed[:i], bc.feed[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// newBlock creates a block on top of parent carrying txs. The extra data tells
+// sibling blocks apart.
+func (bc *testBlockChain) newBlock(parent *types.Block, extra byte, txs ...*types.Transaction) *types.Block {
+	block := types.NewBlock(&types.Header{
+		ParentHash: parent.Hash(),
+		Number:     parent.NumberU64() + 1,
+		GasLimit:   parent.GasLimit(),
+		Extra:      []byte{extra},
+	}, txs, nil)
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.blocks[block.Hash()] = block
+	return block
+}
+
+// setHead makes block the chain head and announces it to the subscribers.
+func (bc *testBlockChain) setHead(block *types.Block) {
+	bc.mu.Lock()
+	bc.head = block
+	feed := append([]chan<- chain.ChainHeadEvent(nil), bc.feed...)
+	bc.mu.Unlock()
+
+	for _, ch := range feed {
+		ch <- chain.ChainHeadEvent{Block: block}
+	}
+}
+
+func transaction(nonce uint64, gasLimit uint64, gasPrice int64) *types.Transaction {
+	return pricedTransaction(nonce, gasLimit, gasPrice, testKey)
+}
+
+func pricedTransaction(nonce uint64, gasLimit uint64, gasPrice int64, key *ecdsa.PrivateKey) *types.Transaction {
+	return types.MustSignNewTx(key, testSigner, &types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: big.NewInt(gasPrice),
+		Gas:      gasLimit,
+		To:       &common.Address{},
+		Value:    big.NewInt(100),
+	})
+}
+
+// waitHead blocks until the pool has moved over to the given head.
+func waitHead(t *testing.T, pool *TxPool, head *types.Block) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		pool.mu.RLock()
+		current := pool.currentHead
+		pool.mu.RUnlock()
+		if current.Hash() == head.Hash() {
+			return
+		}
+	}
+	t.Fatalf("pool did not reach head %d %x", head.NumberU64(), head.Hash())
+}
+
+func setupTxPool() (*TxPool, *testBlockChain) {
+	bc := newTestBlockChain(1000000)
+	bc.statedb.AddBalance(testAddr, big.NewInt(1000000000))
+	return NewTxPool(DefaultConfig, params.TestChainConfig, bc), bc
+}
+
+func TestInvalidTransactions(t *testing.T) {
+	pool, bc := setupTxPool()
+	defer pool.Stop()
+
+	bc.statedb.SetNonce(testAddr, 1)
+	bc.statedb.SetBalance(testAddr, big.NewInt(21000+100))
+
+	tests := []struct {
+		name string
+		tx   *types.Transaction
+		err  error
+	}{
+		{"nonce too low", transaction(0, 21000, 1), chain.ErrNonceTooLow},
+		{"intrinsic gas", transaction(1, 20999, 1), chain.ErrIntrinsicGas},
+		{"insufficient funds", transaction(1, 21000, 2), chain.ErrInsufficientFunds},
+		{"block gas limit", transaction(1, 1000001, 1), ErrGasLimit},
+	}
+	for _, tt := range tests {
+		if err := pool.AddTx(tt.tx); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error mismatch: have %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if err := pool.AddTx(transaction(1, 21000, 1)); err != nil {
+		t.Errorf("valid transaction rejected: %v", err)
+	}
+}
+
+func TestTransactionTypeForkGating(t *testing.T) {
+	bc := newTestBlockChain(1000000)
+	bc.statedb.AddBalance(testAddr, big.NewInt(1000000000))
+
+	// Berlin is scheduled but London is not, so access list transactions are
+	// accepted while dynamic fee transactions are not yet.
+	config := *params.TestChainConfig
+	config.LondonBlock = nil
+	pool := NewTxPool(DefaultConfig, &config, bc)
+	defer pool.Stop()
+
+	dynamic := types.MustSignNewTx(testKey, testSigner, &types.DynamicFeeTx{
+		ChainID:   config.ChainID,
+		Nonce:     0,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(1),
+		Gas:       21000,
+		To:        &common.Address{},
+	})
+	if err := pool.AddTx(dynamic); !errors.Is(err, chain.ErrTxTypeNotSupported) {
+		t.Errorf("dynamic fee transaction error mismatch: have %v, want %v", err, chain.ErrTxTypeNotSupported)
+	}
+	accessList := types.MustSignNewTx(testKey, types.LatestSigner(&config), &types.AccessListTx{
+		ChainID:  config.ChainID,
+		Nonce:    0,
+		GasPrice: big.NewInt(1),
+		Gas:      21000,
+		To:       &common.Address{},
+	})
+	if err := pool.AddTx(accessList); err != nil {
+		t.Errorf("access list transaction rejected: %v", err)
+	}
+}
+
+func TestQueueToPendingPromotion(t *testing.T) {
+	pool, _ := setupTxPool()
+	defer pool.Stop()
+
+	// A nonce gap keeps the transaction in the future queue
+	if err := pool.AddTx(transaction(1, 21000, 1)); err != nil {
+		t.Fatalf("failed to add gapped transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 1 {
+		t.Fatalf("stats mismatch: have %d/%d, want 0/1", pending, queued)
+	}
+	// Filling the gap promotes both transactions
+	if err := pool.AddTx(transaction(0, 21000, 1)); err != nil {
+		t.Fatalf("failed to add gap filler: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 2 || queued != 0 {
+		t.Fatalf("stats mismatch: have %d/%d, want 2/0", pending, queued)
+	}
+	if nonce := pool.Nonce(testAddr); nonce != 2 {
+		t.Errorf("pending nonce mismatch: have %d, want 2", nonce)
+	}
+}
+
+func TestReplaceByFee(t *testing.T) {
+	pool, _ := setupTxPool()
+	defer pool.Stop()
+
+	if err := pool.AddTx(transaction(0, 21000, 100)); err != nil {
+		t.Fatalf("failed to add original transaction: %v", err)
+	}
+	// Below the configured price bump the replacement is rejected
+	if err := pool.AddTx(transaction(0, 21000, 105)); err != ErrReplaceUnderpriced {
+		t.Fatalf("underpriced replacement error mismatch: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	replacement := transaction(0, 21000, 110)
+	if err := pool.AddTx(replacement); err != nil {
+		t.Fatalf("failed to replace transaction: %v", err)
+	}
+	pending := pool.Pending()[testAddr]
+	if len(pending) != 1 || pending[0].Hash() != replacement.Hash() {
+		t.Errorf("pending transaction not replaced: %v", pending)
+	}
+}
+
+func TestUnderpricedEviction(t *testing.T) {
+	bc := newTestBlockChain(1000000)
+
+	config := DefaultConfig
+	config.GlobalSlots = 2
+	config.GlobalQueue = 2
+	pool := NewTxPool(config, params.TestChainConfig, bc)
+	defer pool.Stop()
+
+	keys := make([]*ecdsa.PrivateKey, 6)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		bc.statedb.AddBalance(crypto.PubkeyToAddress(keys[i].PublicKey), big.NewInt(1000000000))
+	}
+	// Fill the pool up to its global limits, one transaction per account
+	txs := make([]*types.Transaction, 4)
+	for i := range txs {
+		txs[i] = pricedTransaction(0, 21000, int64(i+2), keys[i])
+		if err := pool.AddTx(txs[i]); err != nil {
+			t.Fatalf("failed to add transaction %d: %v", i, err)
+		}
+	}
+	// A transaction cheaper than everything in the full pool is refused
+	if err := pool.AddTx(pricedTransaction(0, 21000, 1, keys[4])); !errors.Is(err, ErrUnderpriced) {
+		t.Fatalf("underpriced transaction error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	// A better priced one evicts the cheapest transaction to make room
+	rich := pricedTransaction(0, 21000, 10, keys[5])
+	if err := pool.AddTx(rich); err != nil {
+		t.Fatalf("failed to add well priced transaction: %v", err)
+	}
+	if pool.Has(txs[0].Hash()) {
+		t.Error("cheapest transaction not evicted")
+	}
+	for _, tx := range append(txs[1:], rich) {
+		if !pool.Has(tx.Hash()) {
+			t.Errorf("transaction %x evicted", tx.Hash())
+		}
+	}
+}
+
+func TestReorgReinjection(t *testing.T) {
+	pool, bc := setupTxPool()
+	defer pool.Stop()
+
+	genesis := bc.CurrentBlock()
+	tx := transaction(0, 21000, 1)
+
+	// Include the transaction in a block, consuming the sender nonce
+	included := bc.newBlock(genesis, 0, tx)
+	bc.statedb.SetNonce(testAddr, 1)
+	bc.setHead(included)
+	waitHead(t, pool, included)
+
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Fatalf("stats mismatch: have %d/%d, want 0/0", pending, queued)
+	}
+	// Reorg onto a sibling without the transaction, which must come back
+	sibling := bc.newBlock(genesis, 1)
+	bc.statedb.SetNonce(testAddr, 0)
+	bc.setHead(sibling)
+	waitHead(t, pool, sibling)
+
+	pending := pool.Pending()[testAddr]
+	if len(pending) != 1 || pending[0].Hash() != tx.Hash() {
+		t.Fatalf("dropped transaction not reinjected as pending: %v", pending)
+	}
+}
+
+func TestDeepReorgSkipsReinjection(t *testing.T) {
+	pool, bc := setupTxPool()
+	defer pool.Stop()
+
+	genesis := bc.CurrentBlock()
+	included := bc.newBlock(genesis, 0, transaction(0, 21000, 1))
+	bc.statedb.SetNonce(testAddr, 1)
+	bc.setHead(included)
+	waitHead(t, pool, included)
+
+	// A side chain further than maxReorgDepth away is not walked
+	head := genesis
+	for i := 0; i <= maxReorgDepth+1; i++ {
+		head = bc.newBlock(head, 1)
+	}
+	bc.statedb.SetNonce(testAddr, 0)
+	bc.setHead(head)
+	waitHead(t, pool, head)
+
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Fatalf("stats mismatch: have %d/%d, want 0/0", pending, queued)
+	}
+}
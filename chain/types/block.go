@@ -4,7 +4,6 @@ import (
 	"io"
 	"math/big"
 	"sync/atomic"
-	"time"
 
 	"github.com/universe-30/mt-trie/common"
 	"github.com/universe-30/mt-trie/rlp"
@@ -13,19 +12,31 @@ import (
 type BlockNonce uint64
 
 type Header struct {
-	ParentHash common.Hash    `json:"parentHash"`
-	Coinbase   common.Address `json:"miner"`
-	Root       common.Hash    `json:"stateRoot"`
-	TxHash     common.Hash    `json:"transactionsRoot"`
-
-	GasLimit uint64     `json:"gasLimit"`
-	Number   uint64     `json:"number"`
-	Time     uint64     `json:"timestamp"`
-	Nonce    BlockNonce `json:"nonce"`
+	ParentHash  common.Hash    `json:"parentHash"`
+	Coinbase    common.Address `json:"miner"`
+	Root        common.Hash    `json:"stateRoot"`
+	TxHash      common.Hash    `json:"transactionsRoot"`
+	ReceiptHash common.Hash    `json:"receiptsRoot"`
+	LogsBloom   Bloom          `json:"logsBloom"`
+	Difficulty  *big.Int       `json:"difficulty"`
+
+	GasLimit  uint64      `json:"gasLimit"`
+	GasUsed   uint64      `json:"gasUsed"`
+	Number    uint64      `json:"number"`
+	Time      uint64      `json:"timestamp"`
+	Extra     []byte      `json:"extraData"`
+	MixDigest common.Hash `json:"mixHash"`
+	Nonce     BlockNonce  `json:"nonce"`
 
 	BaseFee *big.Int `json:"baseFeePerGas" rlp:"optional"`
 }
 
+// Body is a simple (mutable, non-safe) data container for storing and moving
+// a block's data contents (transactions) together.
+type Body struct {
+	Transactions []*Transaction
+}
+
 type Block struct {
 	header *Header
 
@@ -38,24 +49,59 @@ type Block struct {
 
 func (b *Block) Transactions() []*Transaction { return b.Txs }
 
-func (b *Block) NumberU64() uint64       { return b.header.Number }
-func (b *Block) GasLimit() uint64        { return b.header.GasLimit }
-func (b *Block) ParentHash() common.Hash { return b.header.ParentHash }
+func (b *Block) NumberU64() uint64        { return b.header.Number }
+func (b *Block) GasLimit() uint64         { return b.header.GasLimit }
+func (b *Block) GasUsed() uint64          { return b.header.GasUsed }
+func (b *Block) Time() uint64             { return b.header.Time }
+func (b *Block) Root() common.Hash        { return b.header.Root }
+func (b *Block) ParentHash() common.Hash  { return b.header.ParentHash }
+func (b *Block) TxHash() common.Hash      { return b.header.TxHash }
+func (b *Block) ReceiptHash() common.Hash { return b.header.ReceiptHash }
+func (b *Block) LogsBloom() Bloom         { return b.header.LogsBloom }
+
+func (b *Block) Difficulty() *big.Int {
+	if b.header.Difficulty == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(b.header.Difficulty)
+}
+
+func (b *Block) BaseFee() *big.Int {
+	if b.header.BaseFee == nil {
+		return nil
+	}
+	return new(big.Int).Set(b.header.BaseFee)
+}
 
 func (b *Block) Header() *Header { return b.header }
 
-func (b *Block) SetFinal(txhash common.Hash, nonce BlockNonce) {
-	b.header.TxHash = txhash
-	b.header.Nonce = nonce
+// Body returns the non-header content of the block.
+func (b *Block) Body() *Body { return &Body{b.Txs} }
+
+// WithSeal returns a new block with the data from b but the header replaced with
+// the sealed one.
+func (b *Block) WithSeal(header *Header) *Block {
+	cpy := *header
+
+	return &Block{
+		header: &cpy,
+		Txs:    b.Txs,
+	}
 }
 
 // 生成新的区块
+//
+// The new block is timestamped one second after prev, so that building on the
+// same parent with the same transactions always yields the same block.
 func CreateNewBlock(prev *Block, txs []*Transaction) *Block {
 
 	header := &Header{}
 	header.Number = prev.NumberU64() + 1
-	header.Time = uint64(time.Now().Unix())
+	header.Time = prev.Time() + 1
 	header.ParentHash = prev.Hash()
+	header.Difficulty = prev.Difficulty()
+	header.GasLimit = prev.GasLimit()
+	header.TxHash = CalcTxHash(txs)
 
 	blk := &Block{header: header}
 	blk.Txs = txs
@@ -63,68 +109,94 @@ func CreateNewBlock(prev *Block, txs []*Transaction) *Block {
 	return blk
 }
 
+// NewBlock creates a new block. The input data is copied, changes to header and
+// to the field values will not affect the block.
+//
+// The values of TxHash, ReceiptHash and LogsBloom in header are ignored and set
+// to values derived from the given txs and receipts.
+func NewBlock(header *Header, txs []*Transaction, receipts []*Receipt) *Block {
+	b := &Block{header: CopyHeader(header)}
+
+	b.header.TxHash = CalcTxHash(txs)
+	b.Txs = make([]*Transaction, len(txs))
+	copy(b.Txs, txs)
+
+	b.header.ReceiptHash = CalcReceiptHash(receipts)
+	b.header.LogsBloom = CreateBloom(receipts)
+
+	return b
+}
+
+// NewBlockWithHeader creates a block with the given header data. The
+// header data is not copied.
 func NewBlockWithHeader(header *Header) *Block {
 	return &Block{header: header}
 }
 
+// CopyHeader creates a deep copy of a block header to prevent side effects from
+// modifying a header variable.
+func CopyHeader(h *Header) *Header {
+	cpy := *h
+	if cpy.Difficulty = new(big.Int); h.Difficulty != nil {
+		cpy.Difficulty.Set(h.Difficulty)
+	}
+	if h.BaseFee != nil {
+		cpy.BaseFee = new(big.Int).Set(h.BaseFee)
+	}
+	if len(h.Extra) > 0 {
+		cpy.Extra = make([]byte, len(h.Extra))
+		copy(cpy.Extra, h.Extra)
+	}
+	return &cpy
+}
+
+// WithBody returns a new block with the given transaction contents.
+func (b *Block) WithBody(transactions []*Transaction) *Block {
+	block := &Block{
+		header: b.header,
+		Txs:    make([]*Transaction, len(transactions)),
+	}
+	copy(block.Txs, transactions)
+	return block
+}
+
 // "external" block encoding. used for eth protocol, etc.
 type extblock struct {
-	Number uint64
-	Time   uint64
+	Header *Header
 	Txs    []*Transaction
 }
 
+// Hash returns the block hash of the header, which is simply the keccak256 hash of its
+// RLP encoding.
+func (h *Header) Hash() common.Hash {
+	return rlpHash(h)
+}
+
+// Hash returns the keccak256 hash of b's header.
+// The hash is computed on the first call and cached thereafter.
 func (b *Block) Hash() common.Hash {
 	if hash := b.hash.Load(); hash != nil {
 		return hash.(common.Hash)
 	}
-
-	v := calculateHash(b)
+	v := b.header.Hash()
 	b.hash.Store(v)
 	return v
 }
 
-func calculateHash(block *Block) common.Hash {
-
-	// data := []byte(block.Number.String()+string(block.Time)) + block.ParentHash
-	// for _, tx := range block.txs {
-	// 	data = data + tx.Hash()
-	// }
-	// bytes := sha256.Sum256([]byte(data))
-
-	// var h common.Hash
-	// copy(h[:], bytes[:])
-
-	h := rlpHash(block)
-	return h
-	// return hex.EncodeToString(bytes[:])
-}
-
-// DecodeRLP decodes
+// DecodeRLP decodes a block from the RLP block format.
 func (b *Block) DecodeRLP(s *rlp.Stream) error {
-	var eb Block
+	var eb extblock
 	if err := s.Decode(&eb); err != nil {
 		return err
 	}
-	*b = eb
+	b.header, b.Txs = eb.Header, eb.Txs
 	return nil
 }
 
 // EncodeRLP serializes b into the RLP block format.
-func (obj *Block) EncodeRLP(_w io.Writer) error {
-	w := rlp.NewEncoderBuffer(_w)
-	_tmp0 := w.List()
-	w.WriteBytes(obj.header.ParentHash[:])
-	if obj.header.Number < 0 {
-		return rlp.ErrNegativeBigInt
-	}
-	w.WriteUint64(obj.header.Number)
-
-	w.WriteUint64(obj.header.Time)
-
-	rlp.Encode(w, obj.Txs)
-
-	w.ListEnd(_tmp0)
-
-	return w.Flush()
+func (b *Block) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, &extblock{
+		Header: b.header,
+		Txs:    b.Txs,
+	})
 }
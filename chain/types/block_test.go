@@ -2,7 +2,11 @@ package types
 
 import (
 	"fmt"
+	"math/big"
 	"testing"
+
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/rlp"
 )
 
 func TestHashBlock(t *testing.T) {
@@ -21,3 +25,46 @@ func TestHashBlock(t *testing.T) {
 		t.Fatal("Hashing block failed.")
 	}
 }
+
+func TestBlockEncoding(t *testing.T) {
+	header := &Header{
+		ParentHash: common.HexToHash("0x01"),
+		Coinbase:   common.HexToAddress("0x8888f1f195afa192cfee860698584c030f4c9db1"),
+		Root:       common.HexToHash("0xef1552a40b7165c3cd773806b9e0c165b75356e0314bf0706f279c729f51e017"),
+		Difficulty: big.NewInt(131072),
+		GasLimit:   3141592,
+		GasUsed:    21000,
+		Number:     1,
+		Time:       1426516743,
+		Extra:      []byte("extra"),
+		Nonce:      0xa13a5a8c8f2bb1c4,
+		BaseFee:    big.NewInt(1000000000),
+	}
+	block := NewBlock(header, []*Transaction{NewTxWithString("data")}, nil)
+
+	enc, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		t.Fatal("encode error: ", err)
+	}
+	var decoded Block
+	if err := rlp.DecodeBytes(enc, &decoded); err != nil {
+		t.Fatal("decode error: ", err)
+	}
+	if decoded.Hash() != block.Hash() {
+		t.Errorf("hash mismatch: have %x, want %x", decoded.Hash(), block.Hash())
+	}
+	if len(decoded.Transactions()) != 1 || decoded.Transactions()[0].Hash() != block.Transactions()[0].Hash() {
+		t.Errorf("transactions not restored")
+	}
+	// Every header field is covered by the hash
+	sealed := CopyHeader(block.Header())
+	sealed.Nonce++
+	if sealed.Hash() == block.Hash() {
+		t.Errorf("hash does not cover the nonce")
+	}
+	sealed = CopyHeader(block.Header())
+	sealed.Root = common.Hash{}
+	if sealed.Hash() == block.Hash() {
+		t.Errorf("hash does not cover the state root")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/universe-30/mt-trie/common"
 	"github.com/universe-30/mt-trie/crypto"
 	"github.com/universe-30/mt-trie/rlp"
+	"github.com/universe-30/mt-trie/trie"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -29,3 +30,83 @@ func rlpHash(x interface{}) (h common.Hash) {
 	sha.Read(h[:])
 	return h
 }
+
+// prefixedRlpHash writes the prefix into the hasher before rlp-encoding x.
+// It's used for typed transactions.
+func prefixedRlpHash(prefix byte, x interface{}) (h common.Hash) {
+	sha := hasherPool.Get().(crypto.KeccakState)
+	defer hasherPool.Put(sha)
+	sha.Reset()
+	sha.Write([]byte{prefix})
+	rlp.Encode(sha, x)
+	sha.Read(h[:])
+	return h
+}
+
+// TrieHasher is the tool used to calculate the hash of derivable list.
+// This is internal, do not use.
+type TrieHasher interface {
+	Reset()
+	Update([]byte, []byte)
+	Hash() common.Hash
+}
+
+// DerivableList is the input to DeriveSha.
+// It is implemented by the 'Transactions' and 'Receipts' types.
+// This is internal, do not use these methods.
+type DerivableList interface {
+	Len() int
+	EncodeIndex(int, *bytes.Buffer)
+}
+
+func encodeForDerive(list DerivableList, i int, buf *bytes.Buffer) []byte {
+	buf.Reset()
+	list.EncodeIndex(i, buf)
+	// It's really unfortunate that we need to do perform this copy.
+	// StackTrie holds onto the values until Hash is called, so the values
+	// written to it must not alias.
+	return common.CopyBytes(buf.Bytes())
+}
+
+// DeriveSha creates the tree hashes of transactions and receipts in a block header.
+func DeriveSha(list DerivableList, hasher TrieHasher) common.Hash {
+	hasher.Reset()
+
+	valueBuf := encodeBufferPool.Get().(*bytes.Buffer)
+	defer encodeBufferPool.Put(valueBuf)
+
+	// StackTrie requires values to be inserted in increasing hash order, which is not the
+	// order that `list` provides hashes in. This insertion sequence ensures that the
+	// order is correct.
+	var indexBuf []byte
+	for i := 1; i < list.Len() && i <= 0x7f; i++ {
+		indexBuf = rlp.AppendUint64(indexBuf[:0], uint64(i))
+		value := encodeForDerive(list, i, valueBuf)
+		hasher.Update(indexBuf, value)
+	}
+	if list.Len() > 0 {
+		indexBuf = rlp.AppendUint64(indexBuf[:0], 0)
+		value := encodeForDerive(list, 0, valueBuf)
+		hasher.Update(indexBuf, value)
+	}
+	for i := 0x80; i < list.Len(); i++ {
+		indexBuf = rlp.AppendUint64(indexBuf[:0], uint64(i))
+		value := encodeForDerive(list, i, valueBuf)
+		hasher.Update(indexBuf, value)
+	}
+	return hasher.Hash()
+}
+
+// CalcTxHash computes the commitment to a list of transactions that is stored
+// in Header.TxHash: the root of the trie keyed by the RLP encoded index of
+// each transaction.
+func CalcTxHash(txs []*Transaction) common.Hash {
+	return DeriveSha(Transactions(txs), trie.NewStackTrie(nil))
+}
+
+// CalcReceiptHash computes the commitment to a list of receipts that is stored
+// in Header.ReceiptHash: the root of the trie keyed by the RLP encoded index of
+// each receipt. Only the consensus fields of each receipt are covered.
+func CalcReceiptHash(receipts []*Receipt) common.Hash {
+	return DeriveSha(Receipts(receipts), trie.NewStackTrie(nil))
+}
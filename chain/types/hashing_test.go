@@ -0,0 +1,32 @@
+package types
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/rlp"
+	"github.com/universe-30/mt-trie/trie"
+)
+
+// TestDeriveSha checks that the stack trie root matches the root of a regular
+// trie holding the same index-keyed values, including lists long enough for
+// the index encoding to grow past a single byte.
+func TestDeriveSha(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 127, 128, 129, 300} {
+		txs := make(Transactions, n)
+		for i := range txs {
+			txs[i] = NewTx(&LegacyTx{Nonce: uint64(i), To: &common.Address{}, Data: []byte{byte(i)}})
+		}
+		want, _ := trie.New(common.Hash{}, trie.NewDatabase(memorydb.New()))
+		for i := range txs {
+			var buf bytes.Buffer
+			txs.EncodeIndex(i, &buf)
+			want.TryUpdate(rlp.AppendUint64(nil, uint64(i)), buf.Bytes())
+		}
+		if have := CalcTxHash(txs); have != want.Hash() {
+			t.Errorf("%d txs: root mismatch: have %x, want %x", n, have, want.Hash())
+		}
+	}
+}
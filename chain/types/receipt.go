@@ -1,7 +1,11 @@
 package types
 
 import (
+	"bytes"
+	"errors"
+
 	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/rlp"
 )
 
 const (
@@ -12,10 +16,15 @@ const (
 	ReceiptStatusSuccessful = uint64(1)
 )
 
+var errEmptyTypedReceipt = errors.New("empty typed receipt bytes")
+
 type Receipt struct {
+	Type              uint8  `json:"type,omitempty"`
 	PostHash          []byte `json:"root"`
 	Status            uint64 `json:"status"`
 	CumulativeGasUsed uint64 `json:"cumulativeGasUsed" gencodec:"required"`
+	Bloom             Bloom  `json:"logsBloom"         gencodec:"required"`
+	Logs              []*Log `json:"logs"              gencodec:"required"`
 
 	TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
 	ContractAddress common.Address `json:"contractAddress"`
@@ -25,3 +34,96 @@ type Receipt struct {
 	BlockNumber      uint64      `json:"blockNumber,omitempty"`
 	TransactionIndex uint        `json:"transactionIndex"`
 }
+
+// receiptRLP is the consensus encoding of a receipt.
+type receiptRLP struct {
+	PostHash          []byte
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*rlpLog
+}
+
+// consensusRLP returns the consensus fields of the receipt, leaving out the
+// lookup fields that are derived once the block is known.
+func (r *Receipt) consensusRLP() *receiptRLP {
+	logs := make([]*rlpLog, len(r.Logs))
+	for i, log := range r.Logs {
+		logs[i] = &rlpLog{Address: log.Address, Topics: log.Topics, Data: log.Data}
+	}
+	return &receiptRLP{
+		PostHash:          r.PostHash,
+		Status:            r.Status,
+		CumulativeGasUsed: r.CumulativeGasUsed,
+		Bloom:             r.Bloom,
+		Logs:              logs,
+	}
+}
+
+// MarshalBinary returns the consensus encoding of the receipt, the same
+// encoding its block's ReceiptHash commits to.
+func (r *Receipt) MarshalBinary() ([]byte, error) {
+	if r.Type == LegacyTxType {
+		return rlp.EncodeToBytes(r.consensusRLP())
+	}
+	var buf bytes.Buffer
+	buf.WriteByte(r.Type)
+	err := rlp.Encode(&buf, r.consensusRLP())
+	return buf.Bytes(), err
+}
+
+// UnmarshalBinary decodes the consensus encoding of receipts.
+// It supports legacy RLP receipts and EIP-2718 typed receipts.
+func (r *Receipt) UnmarshalBinary(b []byte) error {
+	if len(b) > 0 && b[0] > 0x7f {
+		// It's a legacy receipt decode the RLP
+		var data receiptRLP
+		if err := rlp.DecodeBytes(b, &data); err != nil {
+			return err
+		}
+		r.Type = LegacyTxType
+		r.setFromRLP(&data)
+		return nil
+	}
+	// It's an EIP2718 typed tx receipt.
+	if len(b) == 0 {
+		return errEmptyTypedReceipt
+	}
+	switch b[0] {
+	case AccessListTxType, DynamicFeeTxType:
+		var data receiptRLP
+		if err := rlp.DecodeBytes(b[1:], &data); err != nil {
+			return err
+		}
+		r.Type = b[0]
+		r.setFromRLP(&data)
+		return nil
+	default:
+		return ErrTxTypeNotSupported
+	}
+}
+
+// setFromRLP fills in the consensus fields of the receipt.
+func (r *Receipt) setFromRLP(data *receiptRLP) {
+	r.PostHash, r.Status, r.CumulativeGasUsed, r.Bloom = data.PostHash, data.Status, data.CumulativeGasUsed, data.Bloom
+	r.Logs = make([]*Log, len(data.Logs))
+	for i, log := range data.Logs {
+		r.Logs[i] = &Log{Address: log.Address, Topics: log.Topics, Data: log.Data}
+	}
+}
+
+// Receipts implements DerivableList for receipts.
+type Receipts []*Receipt
+
+// Len returns the number of receipts in this list.
+func (rs Receipts) Len() int { return len(rs) }
+
+// EncodeIndex encodes the i'th receipt to w. Typed receipts are prefixed with
+// their transaction type, like the transactions they belong to.
+func (rs Receipts) EncodeIndex(i int, w *bytes.Buffer) {
+	r := rs[i]
+	if r.Type != LegacyTxType {
+		w.WriteByte(r.Type)
+	}
+	rlp.Encode(w, r.consensusRLP())
+}
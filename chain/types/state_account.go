@@ -0,0 +1,16 @@
+package types
+
+import (
+	"math/big"
+
+	"github.com/universe-30/mt-trie/common"
+)
+
+// StateAccount is the consensus representation of accounts.
+// These objects are stored in the main account trie.
+type StateAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     common.Hash // merkle root of the storage trie
+	CodeHash []byte
+}
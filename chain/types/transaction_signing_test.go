@@ -0,0 +1,98 @@
+package types
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+)
+
+func newSigningTestTx() *Transaction {
+	return NewTx(&LegacyTx{
+		Nonce:    0,
+		To:       &common.Address{0xaa},
+		Value:    big.NewInt(10),
+		Gas:      21000,
+		GasPrice: big.NewInt(1),
+	})
+}
+
+func TestSignTxSender(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	signers := []Signer{
+		HomesteadSigner{},
+		NewEIP155Signer(big.NewInt(18)),
+		NewEIP2930Signer(big.NewInt(18)),
+		NewLondonSigner(big.NewInt(18)),
+	}
+	for _, signer := range signers {
+		tx, err := SignTx(newSigningTestTx(), signer, key)
+		if err != nil {
+			t.Fatalf("%T: failed to sign: %v", signer, err)
+		}
+		from, err := Sender(signer, tx)
+		if err != nil {
+			t.Fatalf("%T: failed to recover sender: %v", signer, err)
+		}
+		if from != addr {
+			t.Errorf("%T: sender mismatch: have %x, want %x", signer, from, addr)
+		}
+	}
+}
+
+func TestEIP155ChainIdMismatch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	tx, err := SignTx(newSigningTestTx(), NewEIP155Signer(big.NewInt(1)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tx.Protected() {
+		t.Fatal("expected tx to be replay protected")
+	}
+	if _, err := Sender(NewEIP155Signer(big.NewInt(2)), tx); !errors.Is(err, ErrInvalidChainId) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrInvalidChainId)
+	}
+}
+
+func TestEIP155SignerAcceptsUnprotected(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	tx, err := SignTx(newSigningTestTx(), HomesteadSigner{}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Protected() {
+		t.Fatal("expected tx to be unprotected")
+	}
+	from, err := Sender(NewEIP155Signer(big.NewInt(1)), tx)
+	if err != nil {
+		t.Fatalf("failed to recover sender: %v", err)
+	}
+	if from != addr {
+		t.Fatalf("sender mismatch: have %x, want %x", from, addr)
+	}
+}
+
+func TestSenderCacheSignerMismatch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+
+	tx, err := SignTx(newSigningTestTx(), NewEIP155Signer(big.NewInt(1)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Populate the cache with the matching signer
+	if from, err := Sender(NewEIP155Signer(big.NewInt(1)), tx); err != nil || from != addr {
+		t.Fatalf("sender mismatch: have %x, want %x (err %v)", from, addr, err)
+	}
+	// A signer for another chain must not be served the cached sender
+	if _, err := Sender(NewEIP155Signer(big.NewInt(2)), tx); !errors.Is(err, ErrInvalidChainId) {
+		t.Fatalf("error mismatch: have %v, want %v", err, ErrInvalidChainId)
+	}
+}
@@ -0,0 +1,142 @@
+package types
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+	"github.com/universe-30/mt-trie/rlp"
+)
+
+// newTypedTestTxs returns one signed transaction of every supported type.
+func newTypedTestTxs(t *testing.T) []*Transaction {
+	key, _ := crypto.GenerateKey()
+	signer := NewLondonSigner(big.NewInt(1))
+	to := common.Address{0xaa}
+	accesses := AccessList{{Address: to, StorageKeys: []common.Hash{{0x01}}}}
+
+	txdata := []TxData{
+		&LegacyTx{
+			Nonce:    1,
+			To:       &to,
+			Value:    big.NewInt(10),
+			Gas:      21000,
+			GasPrice: big.NewInt(2),
+			Data:     []byte{0x01, 0x02},
+		},
+		&AccessListTx{
+			ChainID:    big.NewInt(1),
+			Nonce:      2,
+			To:         &to,
+			Value:      big.NewInt(10),
+			Gas:        30000,
+			GasPrice:   big.NewInt(3),
+			AccessList: accesses,
+		},
+		&DynamicFeeTx{
+			ChainID:    big.NewInt(1),
+			Nonce:      3,
+			To:         nil,
+			Value:      big.NewInt(0),
+			Gas:        60000,
+			GasTipCap:  big.NewInt(1),
+			GasFeeCap:  big.NewInt(5),
+			Data:       []byte{0x60, 0x00},
+			AccessList: accesses,
+		},
+	}
+	txs := make([]*Transaction, len(txdata))
+	for i, data := range txdata {
+		tx, err := SignNewTx(key, signer, data)
+		if err != nil {
+			t.Fatalf("failed to sign tx type %d: %v", data.txType(), err)
+		}
+		txs[i] = tx
+	}
+	return txs
+}
+
+func TestTransactionBinaryRoundTrip(t *testing.T) {
+	for _, tx := range newTypedTestTxs(t) {
+		enc, err := tx.MarshalBinary()
+		if err != nil {
+			t.Fatalf("type %d: failed to encode: %v", tx.Type(), err)
+		}
+		if tx.Type() != LegacyTxType && enc[0] != tx.Type() {
+			t.Errorf("type %d: missing type prefix, have %#x", tx.Type(), enc[0])
+		}
+		if size := tx.Size(); int(size) != len(enc) {
+			t.Errorf("type %d: size mismatch: have %v, want %d", tx.Type(), size, len(enc))
+		}
+		dec := new(Transaction)
+		if err := dec.UnmarshalBinary(enc); err != nil {
+			t.Fatalf("type %d: failed to decode: %v", tx.Type(), err)
+		}
+		if dec.Type() != tx.Type() || dec.Hash() != tx.Hash() {
+			t.Errorf("type %d: decoded tx mismatch: have %x, want %x", tx.Type(), dec.Hash(), tx.Hash())
+		}
+		if reenc, _ := dec.MarshalBinary(); !bytes.Equal(reenc, enc) {
+			t.Errorf("type %d: re-encoding mismatch", tx.Type())
+		}
+	}
+}
+
+func TestTransactionHash(t *testing.T) {
+	for _, tx := range newTypedTestTxs(t) {
+		enc, _ := tx.MarshalBinary()
+		// The hash of any transaction is the hash of its canonical encoding,
+		// which for typed transactions includes the leading type byte.
+		if want := crypto.Keccak256Hash(enc); tx.Hash() != want {
+			t.Errorf("type %d: hash mismatch: have %x, want %x", tx.Type(), tx.Hash(), want)
+		}
+		if tx.Type() != LegacyTxType && tx.Hash() == rlpHash(tx.inner) {
+			t.Errorf("type %d: hash does not commit to the type", tx.Type())
+		}
+	}
+}
+
+func TestTransactionBodyRLP(t *testing.T) {
+	txs := newTypedTestTxs(t)
+
+	enc, err := rlp.EncodeToBytes(&Body{Transactions: txs})
+	if err != nil {
+		t.Fatalf("failed to encode body: %v", err)
+	}
+	var body Body
+	if err := rlp.DecodeBytes(enc, &body); err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	if len(body.Transactions) != len(txs) {
+		t.Fatalf("tx count mismatch: have %d, want %d", len(body.Transactions), len(txs))
+	}
+	for i, tx := range body.Transactions {
+		if tx.Type() != txs[i].Type() || tx.Hash() != txs[i].Hash() {
+			t.Errorf("tx %d: mismatch: have type %d hash %x, want type %d hash %x",
+				i, tx.Type(), tx.Hash(), txs[i].Type(), txs[i].Hash())
+		}
+		if tx.Size() != txs[i].Size() {
+			t.Errorf("tx %d: size mismatch: have %v, want %v", i, tx.Size(), txs[i].Size())
+		}
+	}
+	if have, want := CalcTxHash(body.Transactions), CalcTxHash(txs); have != want {
+		t.Errorf("tx root mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestTransactionUnknownType(t *testing.T) {
+	for _, typ := range []byte{0x03, 0x7f} {
+		enc := append([]byte{typ}, 0xc0)
+
+		tx := new(Transaction)
+		if err := tx.UnmarshalBinary(enc); !errors.Is(err, ErrTxTypeNotSupported) {
+			t.Errorf("type %#x: binary error mismatch: have %v, want %v", typ, err, ErrTxTypeNotSupported)
+		}
+		blob, _ := rlp.EncodeToBytes(enc)
+		if err := rlp.DecodeBytes(blob, tx); !errors.Is(err, ErrTxTypeNotSupported) {
+			t.Errorf("type %#x: rlp error mismatch: have %v, want %v", typ, err, ErrTxTypeNotSupported)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package vm
+
+import (
+	"math/big"
+	"math/bits"
+
+	"github.com/universe-30/mt-trie/common"
+)
+
+var (
+	big0   = big.NewInt(0)
+	big1   = big.NewInt(1)
+	big31  = big.NewInt(31)
+	big32  = big.NewInt(32)
+	big256 = big.NewInt(256)
+
+	tt255   = new(big.Int).Lsh(big1, 255)
+	tt256   = new(big.Int).Lsh(big1, 256)
+	tt256m1 = new(big.Int).Sub(tt256, big1)
+)
+
+// u256 encodes x as a 256 bit two's complement number. This operation is destructive.
+func u256(x *big.Int) *big.Int {
+	return x.And(x, tt256m1)
+}
+
+// s256 interprets x as a two's complement number.
+// x must not exceed 256 bits (the result is undefined if it does) and is not modified.
+func s256(x *big.Int) *big.Int {
+	if x.Cmp(tt255) < 0 {
+		return x
+	}
+	return new(big.Int).Sub(x, tt256)
+}
+
+// bigUint64 returns the integer casted to a uint64 and returns whether it
+// overflowed in the process.
+func bigUint64(v *big.Int) (uint64, bool) {
+	return v.Uint64(), !v.IsUint64()
+}
+
+// safeAdd returns x+y and checks for overflow.
+func safeAdd(x, y uint64) (uint64, bool) {
+	sum, carry := bits.Add64(x, y, 0)
+	return sum, carry != 0
+}
+
+// safeMul returns x*y and checks for overflow.
+func safeMul(x, y uint64) (uint64, bool) {
+	hi, lo := bits.Mul64(x, y)
+	return lo, hi != 0
+}
+
+// calcMemSize64 calculates the required memory size, and returns
+// the size and whether the result overflowed uint64
+func calcMemSize64(off, l *big.Int) (uint64, bool) {
+	if !l.IsUint64() {
+		return 0, true
+	}
+	return calcMemSize64WithUint(off, l.Uint64())
+}
+
+// calcMemSize64WithUint calculates the required memory size, and returns
+// the size and whether the result overflowed uint64
+// Identical to calcMemSize64, but length is a uint64
+func calcMemSize64WithUint(off *big.Int, length64 uint64) (uint64, bool) {
+	// if length is zero, memsize is always zero, regardless of offset
+	if length64 == 0 {
+		return 0, false
+	}
+	// Check that offset doesn't overflow
+	offset64, overflow := bigUint64(off)
+	if overflow {
+		return 0, true
+	}
+	val := offset64 + length64
+	// if value < either of it's parts, then it overflowed
+	return val, val < offset64
+}
+
+// getData returns a slice from the data based on the start and size and pads
+// up to size with zero's. This function is overflow safe.
+func getData(data []byte, start uint64, size uint64) []byte {
+	length := uint64(len(data))
+	if start > length {
+		start = length
+	}
+	end := start + size
+	if end > length {
+		end = length
+	}
+	return common.RightPadBytes(data[start:end], int(size))
+}
+
+// toWordSize returns the ceiled word size required for memory expansion.
+func toWordSize(size uint64) uint64 {
+	if size > ^uint64(0)-31 {
+		return ^uint64(0)/32 + 1
+	}
+
+	return (size + 31) / 32
+}
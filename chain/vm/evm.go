@@ -2,50 +2,127 @@ package vm
 
 import (
 	"math/big"
+	"sync/atomic"
 
+	"github.com/universe-30/mt-bc/params"
 	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
 )
 
-const (
-	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract
-
-	CreateDataGas uint64 = 200 //
+// emptyCodeHash is used by create to ensure deployment is disallowed to already
+// deployed contract addresses (relevant after the account abstraction).
+var emptyCodeHash = crypto.Keccak256Hash(nil)
 
+type (
+	// GetHashFunc returns the n'th block hash in the blockchain
+	// and is used by the BLOCKHASH EVM op code.
+	GetHashFunc func(uint64) common.Hash
 )
 
-// Block information
+// BlockContext provides the EVM with auxiliary information. Once provided
+// it shouldn't be modified.
 type BlockContext struct {
-	Coinbase common.Address // Provides information for COINBASE
-	BaseFee  *big.Int       // Provides information for BASEFEE
+	// GetHash returns the hash corresponding to n
+	GetHash GetHashFunc
+
+	// Block information
+	Coinbase    common.Address // Provides information for COINBASE
+	GasLimit    uint64         // Provides information for GASLIMIT
+	BlockNumber *big.Int       // Provides information for NUMBER
+	Time        *big.Int       // Provides information for TIME
+	Difficulty  *big.Int       // Provides information for DIFFICULTY
+	BaseFee     *big.Int       // Provides information for BASEFEE
 }
 
+// TxContext provides the EVM with information about a transaction.
+// All fields can change between transactions.
 type TxContext struct {
 	// Message information
 	Origin   common.Address // Provides information for ORIGIN
 	GasPrice *big.Int       // Provides information for GASPRICE
 }
 
+// EVM is the Ethereum Virtual Machine base object and provides
+// the necessary tools to run a contract on the given state with
+// the provided context. It should be noted that any error
+// generated through any of the calls should be considered a
+// revert-state-and-consume-all-gas operation, no checks on
+// specific errors should ever be performed. The interpreter makes
+// sure that any errors generated are to be considered faulty code.
+//
+// The EVM should never be reused and is not thread safe.
 type EVM struct {
+	// Context provides auxiliary blockchain related information
 	Context   BlockContext
 	TxContext TxContext
-	StateDB   StateDB
+	// StateDB gives access to the underlying state
+	StateDB StateDB
+	// depth is the current call stack
+	depth int
+
+	// chainConfig contains information about the current chain
+	chainConfig *params.ChainConfig
+	// chain rules contains the chain rules for the current epoch
+	chainRules params.Rules
+
+	// interpreter is the contract interpreter
+	interpreter *EVMInterpreter
+	// abort is used to abort the EVM calling operations
+	// NOTE: must be set atomically
+	abort int32
+	// callGasTemp holds the gas available for the current call. This is needed because the
+	// available gas is calculated in gasCall* according to the 63/64 rule and later
+	// applied in opCall*.
+	callGasTemp uint64
 }
 
-// The returned EVM is not thread safe and should only ever be used *once*.
-func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB) *EVM {
+// NewEVM returns a new EVM. The returned EVM is not thread safe and should
+// only ever be used *once*. The rules it enforces are those of chainConfig at
+// the block number of blockCtx.
+func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig *params.ChainConfig) *EVM {
 	evm := &EVM{
-		Context:   blockCtx,
-		TxContext: txCtx,
-		StateDB:   statedb,
+		Context:     blockCtx,
+		TxContext:   txCtx,
+		StateDB:     statedb,
+		chainConfig: chainConfig,
+		chainRules:  chainConfig.Rules(blockCtx.BlockNumber),
 	}
+	evm.interpreter = NewEVMInterpreter(evm, Config{})
 	return evm
 }
 
+// Cancel cancels any running EVM operation. This may be called concurrently and
+// it's safe to be called multiple times.
+func (evm *EVM) Cancel() {
+	atomic.StoreInt32(&evm.abort, 1)
+}
+
+// Cancelled returns true if Cancel has been called
+func (evm *EVM) Cancelled() bool {
+	return atomic.LoadInt32(&evm.abort) == 1
+}
+
+// ChainConfig returns the environment's chain configuration
+func (evm *EVM) ChainConfig() *params.ChainConfig { return evm.chainConfig }
+
+// Interpreter returns the current interpreter
+func (evm *EVM) Interpreter() *EVMInterpreter {
+	return evm.interpreter
+}
+
+// Call executes the contract associated with the addr with the given input as
+// parameters. It also handles any necessary value transfer required and takes
+// the necessary steps to create accounts and reverses the state in case of an
+// execution error or failed value transfer.
 func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas uint64,
 	value *big.Int) (ret []byte, leftOverGas uint64, err error) {
 
 	stateDB := evm.StateDB
 
+	// Fail if we're trying to execute above the call depth limit
+	if evm.depth > int(CallCreateDepth) {
+		return nil, gas, ErrDepth
+	}
 	// Fail if we're trying to transfer more than the available balance
 	if value.Sign() > 0 && !CanTransfer(stateDB, caller.Address(), value) {
 		return nil, gas, ErrInsufficientBalance
@@ -59,8 +136,14 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 
 	// Initialise a new contract and set the code that is to be used by the EVM.
 	// The contract is a scoped environment for this execution context only.
-	// code := stateDB.GetCode(addr)
-
+	code := stateDB.GetCode(addr)
+	if len(code) > 0 {
+		addrCopy := addr
+		contract := NewContract(caller, AccountRef(addrCopy), value, gas)
+		contract.SetCallCode(&addrCopy, stateDB.GetCodeHash(addrCopy), code)
+		ret, err = evm.interpreter.Run(contract, input, false)
+		gas = contract.Gas
+	}
 	// When an error was returned by the EVM or when setting the creation code
 	// above we revert to the snapshot and consume any gas remaining. Additionally
 	// when we're in homestead this also counts for code storage gas errors.
@@ -73,6 +156,123 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	return ret, gas, err
 }
 
+// CallCode executes the contract associated with the addr with the given input
+// as parameters. It also handles any necessary value transfer required and takes
+// the necessary steps to create accounts and reverses the state in case of an
+// execution error or failed value transfer.
+//
+// CallCode differs from Call in the sense that it executes the given address'
+// code with the caller as context.
+func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte, gas uint64,
+	value *big.Int) (ret []byte, leftOverGas uint64, err error) {
+
+	stateDB := evm.StateDB
+
+	// Fail if we're trying to execute above the call depth limit
+	if evm.depth > int(CallCreateDepth) {
+		return nil, gas, ErrDepth
+	}
+	// Fail if we're trying to transfer more than the available balance
+	// Note although it's noop to transfer X ether to caller itself. But
+	// if caller doesn't have enough balance, it would be an error to allow
+	// over-charging itself. So the check here is necessary.
+	if !CanTransfer(stateDB, caller.Address(), value) {
+		return nil, gas, ErrInsufficientBalance
+	}
+	snapshot := stateDB.Snapshot()
+
+	// Initialise a new contract and set the code that is to be used by the EVM.
+	// The contract is a scoped environment for this execution context only.
+	addrCopy := addr
+	contract := NewContract(caller, AccountRef(caller.Address()), value, gas)
+	contract.SetCallCode(&addrCopy, stateDB.GetCodeHash(addrCopy), stateDB.GetCode(addrCopy))
+	ret, err = evm.interpreter.Run(contract, input, false)
+	gas = contract.Gas
+
+	if err != nil {
+		stateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// DelegateCall executes the contract associated with the addr with the given input
+// as parameters. It reverses the state in case of an execution error.
+//
+// DelegateCall differs from CallCode in the sense that it executes the given address'
+// code with the caller as context and the caller is set to the caller of the caller.
+func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []byte,
+	gas uint64) (ret []byte, leftOverGas uint64, err error) {
+
+	stateDB := evm.StateDB
+
+	// Fail if we're trying to execute above the call depth limit
+	if evm.depth > int(CallCreateDepth) {
+		return nil, gas, ErrDepth
+	}
+	snapshot := stateDB.Snapshot()
+
+	// Initialise a new contract and make initialise the delegate values
+	addrCopy := addr
+	contract := NewContract(caller, AccountRef(caller.Address()), nil, gas).AsDelegate()
+	contract.SetCallCode(&addrCopy, stateDB.GetCodeHash(addrCopy), stateDB.GetCode(addrCopy))
+	ret, err = evm.interpreter.Run(contract, input, false)
+	gas = contract.Gas
+
+	if err != nil {
+		stateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
+// StaticCall executes the contract associated with the addr with the given input
+// as parameters while disallowing any modifications to the state during the call.
+// Opcodes that attempt to perform such modifications will result in exceptions
+// instead of performing the modifications.
+func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte,
+	gas uint64) (ret []byte, leftOverGas uint64, err error) {
+
+	stateDB := evm.StateDB
+
+	// Fail if we're trying to execute above the call depth limit
+	if evm.depth > int(CallCreateDepth) {
+		return nil, gas, ErrDepth
+	}
+	// We take a snapshot here. This is a bit counter-intuitive, and could probably be skipped.
+	// However, even a staticcall is considered a 'touch'. On mainnet, static calls were introduced
+	// after all empty accounts were deleted, so this is not required. However, if we omit this,
+	// then certain tests start failing; stRevertTest/RevertPrecompiledTouchExactOOG.json.
+	// We could change this, but for now it's left for legacy reasons
+	snapshot := stateDB.Snapshot()
+
+	// We do an AddBalance of zero here, just in order to trigger a touch.
+	stateDB.AddBalance(addr, big0)
+
+	// Initialise a new contract and set the code that is to be used by the EVM.
+	// The contract is a scoped environment for this execution context only.
+	addrCopy := addr
+	contract := NewContract(caller, AccountRef(addrCopy), new(big.Int), gas)
+	contract.SetCallCode(&addrCopy, stateDB.GetCodeHash(addrCopy), stateDB.GetCode(addrCopy))
+	// When an error was returned by the EVM or when setting the creation code
+	// above we revert to the snapshot and consume any gas remaining. Additionally
+	// when we're in Homestead this also counts for code storage gas errors.
+	ret, err = evm.interpreter.Run(contract, input, true)
+	gas = contract.Gas
+
+	if err != nil {
+		stateDB.RevertToSnapshot(snapshot)
+		if err != ErrExecutionReverted {
+			gas = 0
+		}
+	}
+	return ret, gas, err
+}
+
 func CanTransfer(db StateDB, addr common.Address, amount *big.Int) bool {
 	balance := db.GetBalance(addr)
 	return balance.Cmp(amount) >= 0
@@ -83,26 +283,51 @@ func Transfer(db StateDB, sender, recipient common.Address, amount *big.Int) {
 	db.AddBalance(recipient, amount)
 }
 
+type codeAndHash struct {
+	code []byte
+	hash common.Hash
+}
+
+func (c *codeAndHash) Hash() common.Hash {
+	if c.hash == (common.Hash{}) {
+		c.hash = crypto.Keccak256Hash(c.code)
+	}
+	return c.hash
+}
+
+// create creates a new contract using code as deployment code.
 func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64, value *big.Int,
-	address common.Address) ([]byte, uint64, error) {
+	address common.Address) ([]byte, common.Address, uint64, error) {
 
 	stateDB := evm.StateDB
 
+	// Depth check execution. Fail if we're trying to execute above the
+	// limit.
+	if evm.depth > int(CallCreateDepth) {
+		return nil, common.Address{}, gas, ErrDepth
+	}
 	if !CanTransfer(stateDB, caller.Address(), value) {
-		return nil, gas, ErrInsufficientBalance
+		return nil, common.Address{}, gas, ErrInsufficientBalance
 	}
 	nonce := stateDB.GetNonce(caller.Address())
 	stateDB.SetNonce(caller.Address(), nonce+1)
+	// We add this to the access list _before_ taking a snapshot. Even if the creation fails,
+	// the access-list change should not be rolled back
+	if evm.chainRules.IsBerlin {
+		stateDB.AddAddressToAccessList(address)
+	}
 
 	// Ensure there's no existing contract already at the designated address
 	contractHash := stateDB.GetCodeHash(address)
 	if stateDB.GetNonce(address) != 0 || (contractHash != (common.Hash{}) && contractHash != emptyCodeHash) {
-		return nil, 0, ErrContractAddressCollision
+		return nil, common.Address{}, 0, ErrContractAddressCollision
 	}
 	// Create a new account on the state
 	snapshot := stateDB.Snapshot()
 	stateDB.CreateAccount(address)
-	stateDB.SetNonce(address, 1)
+	if evm.chainRules.IsEIP158 {
+		stateDB.SetNonce(address, 1)
+	}
 
 	Transfer(stateDB, caller.Address(), address, value)
 
@@ -114,12 +339,12 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 	ret, err := evm.interpreter.Run(contract, nil, false)
 
 	// Check whether the max code size has been exceeded, assign err if the case.
-	if len(ret) > MaxCodeSize {
+	if err == nil && evm.chainRules.IsEIP158 && len(ret) > MaxCodeSize {
 		err = ErrMaxCodeSizeExceeded
 	}
 
 	// if the contract creation ran successfully and no errors were returned
-	// calculate the gas requix w xred to store the code. If the code could not
+	// calculate the gas required to store the code. If the code could not
 	// be stored due to not enough gas set an error and let it be handled
 	// by the error checking condition below.
 	if err == nil {
@@ -141,11 +366,25 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		}
 	}
 
-	return ret, contract.Gas, err
+	return ret, address, contract.Gas, err
 }
 
 // Create creates a new contract using code as deployment code.
-func (evm *EVM) Create(contractAddr common.Address, caller ContractRef, code []byte, gas uint64,
-	value *big.Int) ([]byte, uint64, error) {
+func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64,
+	value *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+
+	contractAddr = crypto.CreateAddress(caller.Address(), evm.StateDB.GetNonce(caller.Address()))
 	return evm.create(caller, &codeAndHash{code: code}, gas, value, contractAddr)
 }
+
+// Create2 creates a new contract using code as deployment code.
+//
+// The different between Create2 with Create is Create2 uses sha3(0xff ++ msg.sender ++ salt ++ sha3(init_code))[12:]
+// instead of the usual sender-and-nonce-hash as the address where the contract is initialized at.
+func (evm *EVM) Create2(caller ContractRef, code []byte, gas uint64, endowment *big.Int,
+	salt *big.Int) (ret []byte, contractAddr common.Address, leftOverGas uint64, err error) {
+
+	codeAndHash := &codeAndHash{code: code}
+	contractAddr = crypto.CreateAddress2(caller.Address(), common.BigToHash(salt), codeAndHash.Hash().Bytes())
+	return evm.create(caller, codeAndHash, gas, endowment, contractAddr)
+}
@@ -0,0 +1,243 @@
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+)
+
+func runCode(t *testing.T, code []byte) ([]byte, error) {
+	t.Helper()
+
+	evm := NewEVM(BlockContext{BlockNumber: new(big.Int)}, TxContext{}, nil, params.TestChainConfig)
+	contract := NewContract(AccountRef{}, AccountRef(common.Address{1}), new(big.Int), 100000)
+	contract.Code = code
+	return evm.Interpreter().Run(contract, nil, false)
+}
+
+func TestInterpreterArithmetic(t *testing.T) {
+	// (3 - 5) * 7 stored at memory[0:32] and returned
+	code := []byte{
+		byte(PUSH1), 7,
+		byte(PUSH1), 5,
+		byte(PUSH1), 3,
+		byte(SUB),
+		byte(MUL),
+		byte(PUSH1), 0,
+		byte(MSTORE),
+		byte(PUSH1), 32,
+		byte(PUSH1), 0,
+		byte(RETURN),
+	}
+	ret, err := runCode(t, code)
+	if err != nil {
+		t.Fatalf("execution failed: %v", err)
+	}
+	want := u256(big.NewInt(-14))
+	if have := new(big.Int).SetBytes(ret); have.Cmp(want) != 0 {
+		t.Fatalf("result mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestInterpreterJumps(t *testing.T) {
+	// Jumping to a JUMPDEST opcode succeeds
+	code := []byte{
+		byte(PUSH1), 4,
+		byte(JUMP),
+		byte(INVALID),
+		byte(JUMPDEST),
+		byte(STOP),
+	}
+	if _, err := runCode(t, code); err != nil {
+		t.Fatalf("valid jump failed: %v", err)
+	}
+	// Jumping into the data of a PUSH is rejected, even if the byte is 0x5b
+	code = []byte{
+		byte(PUSH1), 3,
+		byte(JUMP),
+		byte(PUSH1), byte(JUMPDEST),
+		byte(STOP),
+	}
+	if _, err := runCode(t, code); !errors.Is(err, ErrInvalidJump) {
+		t.Fatalf("jump into push data: have %v, want %v", err, ErrInvalidJump)
+	}
+}
+
+func TestInterpreterOutOfGas(t *testing.T) {
+	// An infinite loop must exhaust the gas
+	code := []byte{
+		byte(JUMPDEST),
+		byte(PUSH1), 0,
+		byte(JUMP),
+	}
+	if _, err := runCode(t, code); !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("infinite loop: have %v, want %v", err, ErrOutOfGas)
+	}
+}
+
+var (
+	callerAddr = common.Address{0xca}
+	calleeAddr = common.Address{0xce}
+
+	// storeCode writes 0x2a into storage slot 0.
+	storeCode = []byte{byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(SSTORE), byte(STOP)}
+
+	// returnCode returns 0x2a as a 32 byte word.
+	returnCode = []byte{
+		byte(PUSH1), 0x2a, byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN),
+	}
+)
+
+func newTestEVM(t *testing.T, config *params.ChainConfig) (*EVM, *state.StateDB) {
+	t.Helper()
+
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(memorydb.New()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statedb.SetBalance(callerAddr, big.NewInt(1000))
+	return NewEVM(BlockContext{BlockNumber: new(big.Int)}, TxContext{}, statedb, config), statedb
+}
+
+func TestEVMCall(t *testing.T) {
+	evm, statedb := newTestEVM(t, params.TestChainConfig)
+	statedb.SetCode(calleeAddr, storeCode)
+
+	if _, _, err := evm.Call(AccountRef(callerAddr), calleeAddr, nil, 100000, big.NewInt(10)); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	if value := statedb.GetState(calleeAddr, common.Hash{}); value != common.BytesToHash([]byte{0x2a}) {
+		t.Errorf("storage mismatch: have %x, want 0x2a", value)
+	}
+	if balance := statedb.GetBalance(calleeAddr); balance.Cmp(big.NewInt(10)) != 0 {
+		t.Errorf("value not transferred: have %v, want 10", balance)
+	}
+}
+
+func TestEVMCreate(t *testing.T) {
+	// The init code pushes the runtime code, stores it right aligned in the
+	// first memory word and returns it
+	runtime := returnCode
+	init := append([]byte{byte(PUSH1) + byte(len(runtime)-1)}, runtime...)
+	init = append(init,
+		byte(PUSH1), 0, byte(MSTORE),
+		byte(PUSH1), byte(len(runtime)), byte(PUSH1), byte(32-len(runtime)), byte(RETURN),
+	)
+	for _, eip158 := range []bool{true, false} {
+		config := *params.TestChainConfig
+		if !eip158 {
+			config.EIP158Block = nil
+		}
+		evm, statedb := newTestEVM(t, &config)
+
+		ret, addr, _, err := evm.Create(AccountRef(callerAddr), init, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("eip158 %v: create failed: %v", eip158, err)
+		}
+		if !bytes.Equal(ret, runtime) || !bytes.Equal(statedb.GetCode(addr), runtime) {
+			t.Fatalf("eip158 %v: runtime code mismatch: have %x, want %x", eip158, statedb.GetCode(addr), runtime)
+		}
+		// Contract nonces only start at one since EIP-158
+		want := uint64(0)
+		if eip158 {
+			want = 1
+		}
+		if nonce := statedb.GetNonce(addr); nonce != want {
+			t.Errorf("eip158 %v: contract nonce mismatch: have %d, want %d", eip158, nonce, want)
+		}
+		ret, _, err = evm.Call(AccountRef(callerAddr), addr, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("eip158 %v: call of created contract failed: %v", eip158, err)
+		}
+		if have := new(big.Int).SetBytes(ret); have.Int64() != 0x2a {
+			t.Errorf("eip158 %v: call result mismatch: have %x, want 0x2a", eip158, have)
+		}
+	}
+}
+
+func TestEVMDelegateCall(t *testing.T) {
+	evm, statedb := newTestEVM(t, params.TestChainConfig)
+	statedb.SetCode(calleeAddr, storeCode)
+
+	// The delegated code runs in the storage context of the calling contract
+	parent := NewContract(AccountRef(common.Address{0x01}), AccountRef(callerAddr), new(big.Int), 100000)
+	if _, _, err := evm.DelegateCall(parent, calleeAddr, nil, 100000); err != nil {
+		t.Fatalf("delegate call failed: %v", err)
+	}
+	if value := statedb.GetState(callerAddr, common.Hash{}); value != common.BytesToHash([]byte{0x2a}) {
+		t.Errorf("caller storage mismatch: have %x, want 0x2a", value)
+	}
+	if value := statedb.GetState(calleeAddr, common.Hash{}); value != (common.Hash{}) {
+		t.Errorf("callee storage modified: have %x", value)
+	}
+}
+
+func TestEVMStaticCall(t *testing.T) {
+	evm, statedb := newTestEVM(t, params.TestChainConfig)
+	statedb.SetCode(calleeAddr, storeCode)
+
+	if _, _, err := evm.StaticCall(AccountRef(callerAddr), calleeAddr, nil, 100000); !errors.Is(err, ErrWriteProtection) {
+		t.Fatalf("static call error mismatch: have %v, want %v", err, ErrWriteProtection)
+	}
+	if value := statedb.GetState(calleeAddr, common.Hash{}); value != (common.Hash{}) {
+		t.Errorf("storage modified by static call: have %x", value)
+	}
+	// Read only code runs fine
+	statedb.SetCode(calleeAddr, returnCode)
+	ret, _, err := evm.StaticCall(AccountRef(callerAddr), calleeAddr, nil, 100000)
+	if err != nil {
+		t.Fatalf("static call failed: %v", err)
+	}
+	if have := new(big.Int).SetBytes(ret); have.Int64() != 0x2a {
+		t.Errorf("static call result mismatch: have %x, want 0x2a", have)
+	}
+}
+
+func TestStateAccessGas(t *testing.T) {
+	// Read the balance of an account and a storage slot twice each
+	code := []byte{
+		byte(PUSH1), 0xaa, byte(BALANCE), byte(POP),
+		byte(PUSH1), 0xaa, byte(BALANCE), byte(POP),
+		byte(PUSH1), 0, byte(SLOAD), byte(POP),
+		byte(PUSH1), 0, byte(SLOAD), byte(POP),
+		byte(STOP),
+	}
+	berlin := *params.TestChainConfig
+	berlin.LondonBlock = nil
+	istanbul := berlin
+	istanbul.BerlinBlock = nil
+	frontier := istanbul
+	frontier.IstanbulBlock = nil
+
+	steps := 4*GasFastestStep + 4*GasQuickStep // PUSH1 and POP
+	tests := []struct {
+		name   string
+		config *params.ChainConfig
+		gas    uint64
+	}{
+		// Only the first access of each is cold since EIP-2929
+		{"london", params.TestChainConfig, steps + ColdAccountAccessCostEIP2929 + ColdSloadCostEIP2929 + 2*WarmStorageReadCostEIP2929},
+		{"berlin", &berlin, steps + ColdAccountAccessCostEIP2929 + ColdSloadCostEIP2929 + 2*WarmStorageReadCostEIP2929},
+		{"istanbul", &istanbul, steps + 2*BalanceGasEIP1884 + 2*SloadGasEIP1884},
+		{"frontier", &frontier, steps + 2*BalanceGasEIP150 + 2*SloadGasEIP150},
+	}
+	for _, tt := range tests {
+		evm, statedb := newTestEVM(t, tt.config)
+		statedb.SetCode(calleeAddr, code)
+
+		_, left, err := evm.Call(AccountRef(callerAddr), calleeAddr, nil, 100000, new(big.Int))
+		if err != nil {
+			t.Fatalf("%s: call failed: %v", tt.name, err)
+		}
+		if used := 100000 - left; used != tt.gas {
+			t.Errorf("%s: gas used mismatch: have %d, want %d", tt.name, used, tt.gas)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package vm
+
+const (
+	MaxCodeSize = 24576 // Maximum bytecode to permit for a contract, enforced from EIP 158
+
+	TxGas                     uint64 = 21000 // Per transaction not creating a contract. NOTE: Not payable on data of calls between transactions.
+	TxGasContractCreation     uint64 = 53000 // Per transaction that creates a contract. NOTE: Not payable on data of calls between transactions.
+	TxDataZeroGas             uint64 = 4     // Per byte of data attached to a transaction that equals zero. NOTE: Not payable on data of calls between transactions.
+	TxDataNonZeroGasFrontier  uint64 = 68    // Per byte of data attached to a transaction that is not equal to zero. NOTE: Not payable on data of calls between transactions.
+	TxDataNonZeroGasEIP2028   uint64 = 16    // Per byte of non zero data attached to a transaction after EIP 2028 (part in Istanbul)
+	TxAccessListAddressGas    uint64 = 2400  // Per address specified in EIP 2930 access list
+	TxAccessListStorageKeyGas uint64 = 1900  // Per storage key specified in EIP 2930 access list
+
+	CallCreateDepth uint64 = 1024 // Maximum depth of call/create stack.
+	StackLimit      uint64 = 1024 // Maximum size of VM stack allowed.
+
+	MemoryGas    uint64 = 3   // Times the address of the (highest referenced byte in memory + 1). NOTE: referencing happens on read, write and in instructions such as RETURN and CALL.
+	QuadCoeffDiv uint64 = 512 // Divisor for the quadratic particle of the memory cost equation.
+	CopyGas      uint64 = 3   // Per word of data copied by *COPY instructions.
+
+	Sha3Gas     uint64 = 30 // Once per SHA3 operation.
+	Sha3WordGas uint64 = 6  // Once per word of the SHA3 operation's data.
+
+	ExpGas     uint64 = 10 // Once per EXP instruction
+	ExpByteGas uint64 = 50 // Times ceil(log256(exponent)) for the EXP instruction.
+
+	LogGas      uint64 = 375 // Per LOG* operation.
+	LogTopicGas uint64 = 375 // Multiplied by the * of the LOG*, per LOG transaction. e.g. LOG0 incurs 0 * c_txLogTopicGas, LOG4 incurs 4 * c_txLogTopicGas.
+	LogDataGas  uint64 = 8   // Per byte in a LOG* operation's data.
+
+	JumpdestGas uint64 = 1 // Once per JUMPDEST operation.
+
+	BalanceGasEIP150             uint64 = 400 // The cost of a BALANCE operation after Tangerine
+	BalanceGasEIP1884            uint64 = 700 // The cost of a BALANCE operation after EIP 1884 (part of Istanbul)
+	ExtcodeSizeGas               uint64 = 700 // Cost of EXTCODESIZE
+	ExtcodeCopyBase              uint64 = 700 // Base cost of EXTCODECOPY
+	ExtcodeHashGasConstantinople uint64 = 400 // Cost of EXTCODEHASH (introduced in Constantinople)
+	ExtcodeHashGasEIP1884        uint64 = 700 // Cost of EXTCODEHASH after EIP 1884 (part in Istanbul)
+	SloadGasEIP150               uint64 = 200 // Cost of SLOAD after Tangerine
+	SloadGasEIP1884              uint64 = 800 // Cost of SLOAD after EIP 1884 (part of Istanbul)
+
+	SstoreSetGas    uint64 = 20000 // Once per SSTORE operation from clean zero to non-zero.
+	SstoreResetGas  uint64 = 5000  // Once per SSTORE operation from clean non-zero to something else.
+	SstoreRefundGas uint64 = 15000 // Once per SSTORE operation if the storage slot is cleared.
+
+	SloadGasEIP2200                   uint64 = 800   // Cost of SLOAD after EIP 2200 (part of Istanbul)
+	SstoreSentryGasEIP2200            uint64 = 2300  // Minimum gas required to be present for an SSTORE call, not consumed
+	SstoreSetGasEIP2200               uint64 = 20000 // Once per SSTORE operation from clean zero to non-zero
+	SstoreResetGasEIP2200             uint64 = 5000  // Once per SSTORE operation from clean non-zero to something else
+	SstoreClearsScheduleRefundEIP2200 uint64 = 15000 // Once per SSTORE operation for clearing an originally existing storage slot
+
+	ColdAccountAccessCostEIP2929 uint64 = 2600 // COLD_ACCOUNT_ACCESS_COST
+	ColdSloadCostEIP2929         uint64 = 2100 // COLD_SLOAD_COST
+	WarmStorageReadCostEIP2929   uint64 = 100  // WARM_STORAGE_READ_COST
+
+	// In EIP-2200: SstoreResetGas was 5000.
+	// In EIP-2929: SstoreResetGas was changed to '5000 - COLD_SLOAD_COST'.
+	// In EIP-3529: SSTORE_CLEARS_SCHEDULE is defined as SSTORE_RESET_GAS + ACCESS_LIST_STORAGE_KEY_COST
+	// Which becomes: 5000 - 2100 + 1900 = 4800
+	SstoreClearsScheduleRefundEIP3529 uint64 = SstoreResetGasEIP2200 - ColdSloadCostEIP2929 + TxAccessListStorageKeyGas
+
+	CallGas              uint64 = 700   // Static portion of gas for CALL-derivates.
+	CallValueTransferGas uint64 = 9000  // Paid for CALL when the value transfer is non-zero.
+	CallNewAccountGas    uint64 = 25000 // Paid for CALL when the destination address didn't exist prior.
+	CallStipend          uint64 = 2300  // Free gas given at beginning of call.
+
+	CreateGas     uint64 = 32000 // Once per CREATE operation & contract-creation transaction.
+	Create2Gas    uint64 = 32000 // Once per CREATE2 operation
+	CreateDataGas uint64 = 200   // Per byte of deployed contract code.
+
+	SelfdestructGas         uint64 = 5000  // Cost of SELFDESTRUCT
+	CreateBySelfdestructGas uint64 = 25000 // Paid for SELFDESTRUCT when the beneficiary didn't exist prior.
+	SelfdestructRefundGas   uint64 = 24000 // Refunded following a selfdestruct operation.
+
+	RefundQuotient        uint64 = 2 // Maximum refund is gasUsed / RefundQuotient.
+	RefundQuotientEIP3529 uint64 = 5 // Maximum refund is gasUsed / RefundQuotientEIP3529 after London.
+)
@@ -0,0 +1,53 @@
+package vm
+
+import (
+	"math/big"
+)
+
+// Stack is an object for basic stack operations. Items popped to the stack are
+// expected to be changed and modified. stack does not take care of adding newly
+// initialised objects.
+type Stack struct {
+	data []*big.Int
+}
+
+func newstack() *Stack {
+	return &Stack{data: make([]*big.Int, 0, StackLimit)}
+}
+
+// Data returns the underlying big.Int array.
+func (st *Stack) Data() []*big.Int {
+	return st.data
+}
+
+func (st *Stack) push(d *big.Int) {
+	// NOTE push limit (1024) is checked in baseCheck
+	st.data = append(st.data, d)
+}
+
+func (st *Stack) pop() (ret *big.Int) {
+	ret = st.data[len(st.data)-1]
+	st.data = st.data[:len(st.data)-1]
+	return
+}
+
+func (st *Stack) len() int {
+	return len(st.data)
+}
+
+func (st *Stack) swap(n int) {
+	st.data[st.len()-n], st.data[st.len()-1] = st.data[st.len()-1], st.data[st.len()-n]
+}
+
+func (st *Stack) dup(n int) {
+	st.push(new(big.Int).Set(st.data[st.len()-n]))
+}
+
+func (st *Stack) peek() *big.Int {
+	return st.data[st.len()-1]
+}
+
+// Back returns the n'th item in stack
+func (st *Stack) Back(n int) *big.Int {
+	return st.data[st.len()-n-1]
+}
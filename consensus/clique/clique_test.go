@@ -0,0 +1,231 @@
+package clique
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+)
+
+// testerChain is an in-memory header chain indexed the same way as the real
+// blockchain, serving the headers the engine needs for its snapshots.
+type testerChain struct {
+	headers map[common.Hash]*types.Header
+	numbers map[uint64]*types.Header
+	head    *types.Header
+}
+
+func (c *testerChain) CurrentHeader() *types.Header { return c.head }
+
+func (c *testerChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number == number {
+		return header
+	}
+	return nil
+}
+
+func (c *testerChain) GetHeaderByNumber(number uint64) *types.Header { return c.numbers[number] }
+
+func (c *testerChain) GetHeaderByHash(hash common.Hash) *types.Header { return c.headers[hash] }
+
+func (c *testerChain) insert(header *types.Header) common.Hash {
+	hash := header.Hash()
+	c.headers[hash], c.numbers[header.Number], c.head = header, header, header
+	return hash
+}
+
+// tester holds a set of signing keys sorted by their addresses, so the index
+// of a key is also its turn in the round robin.
+type tester struct {
+	keys   []*ecdsa.PrivateKey
+	chain  *testerChain
+	engine *Clique
+	head   common.Hash
+}
+
+func newTester(t *testing.T, signers int, config *Config) *tester {
+	keys := make([]*ecdsa.PrivateKey, signers)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return signersAscending{crypto.PubkeyToAddress(keys[i].PublicKey), crypto.PubkeyToAddress(keys[j].PublicKey)}.Less(0, 1)
+	})
+	genesis := &types.Header{Difficulty: new(big.Int).Set(diffNoTurn), Extra: make([]byte, extraVanity)}
+	for _, key := range keys {
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		genesis.Extra = append(genesis.Extra, addr[:]...)
+	}
+	genesis.Extra = append(genesis.Extra, make([]byte, extraSeal)...)
+
+	chain := &testerChain{headers: make(map[common.Hash]*types.Header), numbers: make(map[uint64]*types.Header)}
+	return &tester{
+		keys:   keys,
+		chain:  chain,
+		engine: New(config, memorydb.New()),
+		head:   chain.insert(genesis),
+	}
+}
+
+// block prepares a header on top of the current head as the given signer and
+// signs it, without inserting it.
+func (tt *tester) block(t *testing.T, signer int) *types.Header {
+	key := tt.keys[signer]
+	tt.engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), nil)
+
+	header := &types.Header{ParentHash: tt.head, Number: tt.chain.head.Number + 1}
+	if err := tt.engine.Prepare(tt.chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	sig, err := crypto.Sign(SealHash(header).Bytes(), key)
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+	return header
+}
+
+// extend signs a block on top of the head and imports it if valid.
+func (tt *tester) extend(t *testing.T, signer int) error {
+	header := tt.block(t, signer)
+	if err := tt.engine.VerifyHeader(tt.chain, header, true); err != nil {
+		return err
+	}
+	tt.head = tt.chain.insert(header)
+	return nil
+}
+
+func TestRoundRobinSigning(t *testing.T) {
+	tt := newTester(t, 3, &Config{Epoch: 30000})
+
+	// Signers taking their turns produce in-turn blocks
+	for number := uint64(1); number <= 6; number++ {
+		header := tt.block(t, int(number%3))
+		if header.Difficulty.Cmp(diffInTurn) != 0 {
+			t.Fatalf("block %d: difficulty mismatch: have %v, want %v", number, header.Difficulty, diffInTurn)
+		}
+		if err := tt.engine.VerifyHeader(tt.chain, header, true); err != nil {
+			t.Fatalf("block %d: in-turn header rejected: %v", number, err)
+		}
+		tt.head = tt.chain.insert(header)
+
+		signer, err := tt.engine.Author(header)
+		if err != nil || signer != crypto.PubkeyToAddress(tt.keys[number%3].PublicKey) {
+			t.Fatalf("block %d: author mismatch: have %x (%v)", number, signer, err)
+		}
+	}
+	// Block 7 is signer 1's turn, signer 2 may sign it out of turn
+	header := tt.block(t, 2)
+	if header.Difficulty.Cmp(diffNoTurn) != 0 {
+		t.Fatalf("out-of-turn difficulty mismatch: have %v, want %v", header.Difficulty, diffNoTurn)
+	}
+	// Claiming the in-turn difficulty out of turn is rejected
+	forged := types.CopyHeader(header)
+	forged.Difficulty = new(big.Int).Set(diffInTurn)
+	sig, _ := crypto.Sign(SealHash(forged).Bytes(), tt.keys[2])
+	copy(forged.Extra[len(forged.Extra)-extraSeal:], sig)
+	if err := tt.engine.VerifyHeader(tt.chain, forged, true); err != errWrongDifficulty {
+		t.Errorf("forged difficulty error mismatch: have %v, want %v", err, errWrongDifficulty)
+	}
+	if err := tt.engine.VerifyHeader(tt.chain, header, true); err != nil {
+		t.Fatalf("out-of-turn header rejected: %v", err)
+	}
+	tt.head = tt.chain.insert(header)
+
+	// Signer 2 just signed, it can't sign again until the others did
+	if err := tt.extend(t, 2); err != errRecentlySigned {
+		t.Errorf("recent signer error mismatch: have %v, want %v", err, errRecentlySigned)
+	}
+}
+
+func TestUnauthorizedSigner(t *testing.T) {
+	tt := newTester(t, 2, &Config{Epoch: 30000})
+
+	outsider, _ := crypto.GenerateKey()
+	tt.keys = append(tt.keys, outsider)
+	if err := tt.extend(t, 2); !errors.Is(err, errUnauthorizedSigner) {
+		t.Errorf("unauthorized signer error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+}
+
+func TestSignatureCoversBloom(t *testing.T) {
+	tt := newTester(t, 2, &Config{Epoch: 30000})
+
+	header := tt.block(t, 1)
+	forged := types.CopyHeader(header)
+	forged.LogsBloom[0] ^= 0xff
+	if SealHash(forged) == SealHash(header) {
+		t.Fatal("seal hash does not cover the logs bloom")
+	}
+	// The signature no longer recovers to the signer of the block
+	if err := tt.engine.VerifyHeader(tt.chain, forged, true); !errors.Is(err, errUnauthorizedSigner) {
+		t.Errorf("swapped bloom error mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	if err := tt.engine.VerifyHeader(tt.chain, header, true); err != nil {
+		t.Errorf("valid header rejected: %v", err)
+	}
+}
+
+func TestSignerVoting(t *testing.T) {
+	tt := newTester(t, 2, &Config{Epoch: 30000})
+
+	candidate, _ := crypto.GenerateKey()
+	addr := crypto.PubkeyToAddress(candidate.PublicKey)
+	tt.engine.Propose(addr, true)
+
+	// Both signers vote the candidate in, the second vote passes the proposal
+	for i, signer := range []int{1, 0} {
+		header := tt.block(t, signer)
+		if header.Coinbase != addr || header.Nonce != nonceAuthVote {
+			t.Fatalf("vote %d not cast: coinbase %x, nonce %x", i, header.Coinbase, header.Nonce)
+		}
+		if err := tt.engine.VerifyHeader(tt.chain, header, true); err != nil {
+			t.Fatalf("vote %d rejected: %v", i, err)
+		}
+		tt.head = tt.chain.insert(header)
+	}
+	snap, err := tt.engine.snapshot(tt.chain, tt.chain.head.Number, tt.head, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if _, ok := snap.Signers[addr]; !ok || len(snap.Signers) != 3 {
+		t.Fatalf("candidate not authorized: signers %v", snap.signers())
+	}
+	// Once passed, there is nothing left to vote on
+	tt.keys = append(tt.keys, candidate)
+	sort.Slice(tt.keys, func(i, j int) bool {
+		return signersAscending{crypto.PubkeyToAddress(tt.keys[i].PublicKey), crypto.PubkeyToAddress(tt.keys[j].PublicKey)}.Less(0, 1)
+	})
+	if header := tt.block(t, 0); header.Coinbase != (common.Address{}) {
+		t.Errorf("stale vote cast on %x", header.Coinbase)
+	}
+}
+
+func TestCheckpointSigners(t *testing.T) {
+	tt := newTester(t, 2, &Config{Epoch: 2})
+
+	if err := tt.extend(t, 1); err != nil {
+		t.Fatalf("failed to extend chain: %v", err)
+	}
+	// Block 2 is a checkpoint and must list the authorized signers
+	header := tt.block(t, 0)
+	if have, want := len(header.Extra), extraVanity+2*common.AddressLength+extraSeal; have != want {
+		t.Fatalf("checkpoint extra-data length mismatch: have %d, want %d", have, want)
+	}
+	forged := types.CopyHeader(header)
+	forged.Extra[extraVanity] ^= 0xff
+	sig, _ := crypto.Sign(SealHash(forged).Bytes(), tt.keys[0])
+	copy(forged.Extra[len(forged.Extra)-extraSeal:], sig)
+	if err := tt.engine.VerifyHeader(tt.chain, forged, true); err != errMismatchingCheckpointSigners {
+		t.Errorf("forged checkpoint error mismatch: have %v, want %v", err, errMismatchingCheckpointSigners)
+	}
+	if err := tt.engine.VerifyHeader(tt.chain, header, true); err != nil {
+		t.Fatalf("checkpoint header rejected: %v", err)
+	}
+}
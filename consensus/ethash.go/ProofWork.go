@@ -1,128 +1,362 @@
 package ethash
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"encoding/binary"
+	"errors"
+	"fmt"
 	"log"
 	"math/big"
-
-	"github.com/universe-30/mt-bc/chain/types"
-	"github.com/universe-30/mt-trie/common"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// two256 is a big integer representing 2^256
+var two256 = new(big.Int).Exp(big.NewInt(2), big.NewInt(256), big.NewInt(0))
+
 /**
-target计算方式  假设：Hash为8位，targetBit为2位
-eg:0000 0001(8位的Hash)
-1.8-2 = 6 将上值左移6位
-2.0000 0001 << 6 = 0100 0000 = target
-3.只要计算的Hash满足 ：hash < target，便是符合POW的哈希值
+target计算方式  target = 2^256 / difficulty
+1.难度由 CalcDifficulty 根据父区块的出块时间逐块调整
+2.由 hashimoto 根据区块所在 epoch 的缓存/数据集计算 (digest, result)
+3.只要计算的 result 满足 ：result <= target，便是符合POW的哈希值
 */
 
-// 16 个 0
-const targetBits = 16
+// algorithmRevision is the data structure version used for file naming.
+const algorithmRevision = 23
+
+// Mode defines the type and amount of PoW verification an ethash engine makes.
+type Mode uint
+
+const (
+	ModeNormal Mode = iota
+	ModeTest
+	ModeFake
+)
+
+// Config are the configuration parameters of the ethash.
+type Config struct {
+	CacheDir       string // Directory to store the verification caches in, memory only if empty
+	CachesInMem    int    // Number of recent verification caches to keep in memory
+	CachesOnDisk   int    // Number of recent verification caches to keep on disk
+	DatasetDir     string // Directory to store the mining datasets in, memory only if empty
+	DatasetsInMem  int    // Number of recent mining datasets to keep in memory
+	DatasetsOnDisk int    // Number of recent mining datasets to keep on disk
+	PowMode        Mode
+}
+
+// DefaultConfig contains the default settings of the proof-of-work engine.
+var DefaultConfig = Config{
+	CachesInMem:    2,
+	CachesOnDisk:   3,
+	DatasetsInMem:  1,
+	DatasetsOnDisk: 2,
+	PowMode:        ModeNormal,
+}
 
 type ProofOfWork struct {
-	//工作量难度 big.Int大数存储
-	target *big.Int
+	hashes uint64 // Number of nonces tried in the current sealing run (atomic, keep first for alignment)
+
+	config Config
+
+	caches   *lru // In memory caches to avoid regenerating too often
+	datasets *lru // In memory datasets to avoid regenerating too often
+
+	// Mining related fields
+	rand      *rand.Rand // Properly seeded random source for nonces
+	threads   int        // Number of threads to mine on if mining
+	sealStart time.Time  // Start time of the current sealing run
+	sealEnd   time.Time  // End time of the last sealing run, zero if running
+	lock      sync.Mutex // Ensures thread safety for the in-memory caches and mining fields
+
 }
 
-func NewProofOfWork() *ProofOfWork {
+// New creates a full sized ethash PoW scheme with the given configuration.
+func New(config Config) *ProofOfWork {
+	if config.CachesInMem <= 0 {
+		log.Printf("One ethash cache must always be in memory, requested %d", config.CachesInMem)
+		config.CachesInMem = 1
+	}
+	if config.DatasetsInMem <= 0 {
+		config.DatasetsInMem = 1
+	}
+	if config.CacheDir != "" && config.CachesOnDisk > 0 {
+		log.Printf("Disk storage enabled for ethash caches, dir %s, count %d", config.CacheDir, config.CachesOnDisk)
+	}
+	if config.DatasetDir != "" && config.DatasetsOnDisk > 0 {
+		log.Printf("Disk storage enabled for ethash DAGs, dir %s, count %d", config.DatasetDir, config.DatasetsOnDisk)
+	}
+	return &ProofOfWork{
+		config:   config,
+		caches:   newlru(config.CachesInMem, newCache),
+		datasets: newlru(config.DatasetsInMem, newDataset),
+	}
+}
 
-	//1.创建一个初始值为1的target
-	target := big.NewInt(1)
-	//2.左移bits(Hash) - targetBit 位
-	target = target.Lsh(target, 256-targetBits)
+// NewProofOfWork creates a full sized ethash PoW scheme with the default
+// configuration, keeping its caches and datasets in memory only.
+func NewProofOfWork() *ProofOfWork {
+	return New(DefaultConfig)
+}
 
-	// target  = new(big.Int).Div(two256, header.Difficulty)
+// NewTester creates a small sized ethash PoW scheme useful only for testing
+// purposes.
+func NewTester() *ProofOfWork {
+	return New(Config{PowMode: ModeTest})
+}
 
-	return &ProofOfWork{target}
+// NewFaker creates a proof-of-work engine that accepts all seals as valid and
+// seals blocks instantly, for tests that need an engine but not the work.
+func NewFaker() *ProofOfWork {
+	return New(Config{PowMode: ModeFake})
 }
 
-func (pow *ProofOfWork) prepareData(block *types.Block) []byte {
+// lru tracks caches or datasets by their last use time, keeping at most N of them.
+type lru struct {
+	new func(epoch uint64) interface{}
 
-	data := bytes.Join(
-		[][]byte{
-			block.Hash().Bytes(),
-			IntToHex(int64(targetBits)),
-		},
-		[]byte{},
-	)
+	mu    sync.Mutex
+	items map[uint64]interface{}
+	order []uint64 // Epochs of the tracked items, most recently used last
+	limit int
+}
 
-	return data
+// newlru create a new least-recently-used cache for either the verification caches
+// or the mining datasets.
+func newlru(maxItems int, new func(epoch uint64) interface{}) *lru {
+	return &lru{
+		new:   new,
+		items: make(map[uint64]interface{}),
+		limit: maxItems,
+	}
 }
 
-func (pow *ProofOfWork) Seal(block *types.Block) (common.Hash, types.BlockNonce, error) {
+// get retrieves or creates an item for the given epoch. The item is not
+// generated, that is up to the caller.
+func (lru *lru) get(epoch uint64) interface{} {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
 
-	// Start generating random nonces until we abort or find a good one
-	var (
-		attempts  = int64(0)
-		powBuffer = new(big.Int)
-		target    = pow.target
-	)
+	// Move the epoch to the most recently used end of the ordering
+	for i, e := range lru.order {
+		if e == epoch {
+			lru.order = append(lru.order[:i], lru.order[i+1:]...)
+			break
+		}
+	}
+	lru.order = append(lru.order, epoch)
+
+	item, ok := lru.items[epoch]
+	if !ok {
+		item = lru.new(epoch)
+		lru.items[epoch] = item
+	}
+	// Evict the least recently used items over the limit
+	for len(lru.order) > lru.limit {
+		delete(lru.items, lru.order[0])
+		lru.order = lru.order[1:]
+	}
+	return item
+}
 
-	var nonce uint64
-	nonce = 0
-	// nonce    = seed
+// cache wraps an ethash cache with some metadata to allow easier concurrent use.
+type cache struct {
+	epoch uint64    // Epoch for which this cache is relevant
+	cache []uint32  // The actual cache data content
+	once  sync.Once // Ensures the cache is generated only once
+}
 
-	//准备数据
-	dataBytes := pow.prepareData(block)
+// newCache creates a new ethash verification cache.
+func newCache(epoch uint64) interface{} {
+	return &cache{epoch: epoch}
+}
 
-	// logger.Trace("Started ethash search for new nonces", "seed", seed)
+// generate ensures that the cache content is generated before use.
+func (c *cache) generate(dir string, limit int, test bool) {
+	c.once.Do(func() {
+		size := cacheSize(c.epoch*epochLength + 1)
+		seed := seedHash(c.epoch*epochLength + 1)
+		if test {
+			size = 1024
+		}
+		// If we don't store anything on disk, generate and return.
+		if dir == "" || limit <= 0 {
+			c.cache = generateCache(size, seed)
+			return
+		}
+		path := filepath.Join(dir, fmt.Sprintf("cache-R%d-%x", algorithmRevision, seed[:8]))
 
-	for {
-		attempts++
+		// Try to load the file from disk and generate it if not found
+		var err error
+		if c.cache, err = loadDataFile(path, size); err == nil {
+			log.Printf("Loaded old ethash cache from disk, epoch %d", c.epoch)
+			return
+		}
+		log.Printf("Failed to load old ethash cache, epoch %d: %v", c.epoch, err)
 
-		// Compute the PoW value of this nonce
-		hash := hashimotoFull(dataBytes, nonce)
-		if powBuffer.SetBytes(hash[:]).Cmp(target) <= 0 {
-			return common.BytesToHash(hash[:]), types.BlockNonce(nonce), nil
+		c.cache = generateCache(size, seed)
+		if err := storeDataFile(path, c.cache); err != nil {
+			log.Printf("Failed to store ethash cache, epoch %d: %v", c.epoch, err)
 		}
+		// Iterate over all previous instances and delete old ones
+		if c.epoch >= uint64(limit) {
+			seed := seedHash((c.epoch-uint64(limit))*epochLength + 1)
+			os.Remove(filepath.Join(dir, fmt.Sprintf("cache-R%d-%x", algorithmRevision, seed[:8])))
+		}
+	})
+}
 
-		nonce++
-	}
+// dataset wraps an ethash dataset with some metadata to allow easier concurrent use.
+type dataset struct {
+	epoch   uint64    // Epoch for which this cache is relevant
+	dataset []uint32  // The actual cache data content
+	once    sync.Once // Ensures the cache is generated only once
+}
 
-	return common.Hash{}, 0, nil
+// newDataset creates a new ethash mining dataset.
+func newDataset(epoch uint64) interface{} {
+	return &dataset{epoch: epoch}
 }
 
-// hashimotoFull aggregates data from the full dataset (using the full in-memory
-// dataset) in order to produce our final value for a particular header hash and
-// nonce.
-func hashimotoFull(dataset []byte, nonce uint64) [32]byte {
-	// Compute the PoW value of this nonce
+// generate ensures that the dataset content is generated before use.
+func (d *dataset) generate(dir string, limit int, test bool) {
+	d.once.Do(func() {
+		csize := cacheSize(d.epoch*epochLength + 1)
+		dsize := datasetSize(d.epoch*epochLength + 1)
+		seed := seedHash(d.epoch*epochLength + 1)
+		if test {
+			csize = 1024
+			dsize = 32 * 1024
+		}
+		// If we don't store anything on disk, generate and return
+		if dir == "" || limit <= 0 {
+			d.dataset = generateDataset(dsize, generateCache(csize, seed))
+			return
+		}
+		path := filepath.Join(dir, fmt.Sprintf("full-R%d-%x", algorithmRevision, seed[:8]))
 
-	pad := IntToHex(int64(nonce))
+		// Try to load the file from disk and generate it if not found
+		var err error
+		if d.dataset, err = loadDataFile(path, dsize); err == nil {
+			log.Printf("Loaded old ethash dataset from disk, epoch %d", d.epoch)
+			return
+		}
+		log.Printf("Failed to load old ethash dataset, epoch %d: %v", d.epoch, err)
 
-	data := bytes.Join(
-		[][]byte{
-			dataset,
-			pad,
-		},
-		[]byte{},
-	)
-	hash := sha256.Sum256(data)
-	return hash
+		d.dataset = generateDataset(dsize, generateCache(csize, seed))
+		if err := storeDataFile(path, d.dataset); err != nil {
+			log.Printf("Failed to store ethash dataset, epoch %d: %v", d.epoch, err)
+		}
+		// Iterate over all previous instances and delete old ones
+		if d.epoch >= uint64(limit) {
+			seed := seedHash((d.epoch-uint64(limit))*epochLength + 1)
+			os.Remove(filepath.Join(dir, fmt.Sprintf("full-R%d-%x", algorithmRevision, seed[:8])))
+		}
+	})
 }
 
-func UintToHex(num uint64) []byte {
+// errDataFileSize is returned if a cache or dataset file on disk doesn't have
+// the size expected for its epoch.
+var errDataFileSize = errors.New("data file size mismatch")
 
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, num)
+// loadDataFile reads a cache or dataset of the given byte size from disk.
+func loadDataFile(path string, size uint64) ([]uint32, error) {
+	blob, err := os.ReadFile(path)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
+	}
+	if uint64(len(blob)) != size {
+		return nil, errDataFileSize
 	}
+	return bytesToUint32s(blob), nil
+}
 
-	return buff.Bytes()
+// storeDataFile writes a cache or dataset to disk, going through a temporary
+// file so that a crash never leaves a truncated file behind.
+func storeDataFile(path string, data []uint32) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp := path + "." + fmt.Sprint(rand.Int63())
+	if err := os.WriteFile(temp, uint32sToBytes(data), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
 }
 
-func IntToHex(num int64) []byte {
+// cache tries to retrieve a verification cache for the specified block number
+// by first checking against a list of in-memory caches, then against caches
+// stored on disk, and finally generating one if none can be found.
+func (pow *ProofOfWork) cache(block uint64) *cache {
+	epoch := block / epochLength
+	current := pow.caches.get(epoch).(*cache)
 
-	buff := new(bytes.Buffer)
-	err := binary.Write(buff, binary.BigEndian, num)
-	if err != nil {
+	// Wait for generation finish.
+	current.generate(pow.config.CacheDir, pow.config.CachesOnDisk, pow.config.PowMode == ModeTest)
+	return current
+}
+
+// dataset tries to retrieve a mining dataset for the specified block number
+// by first checking against a list of in-memory datasets, then against DAGs
+// stored on disk, and finally generating one if none can be found.
+func (pow *ProofOfWork) dataset(block uint64) *dataset {
+	epoch := block / epochLength
+	current := pow.datasets.get(epoch).(*dataset)
+
+	// Wait for generation finish.
+	current.generate(pow.config.DatasetDir, pow.config.DatasetsOnDisk, pow.config.PowMode == ModeTest)
+	return current
+}
+
+// datasetSize returns the size of the dataset a block is verified against,
+// honouring the tiny datasets of the test mode.
+func (pow *ProofOfWork) datasetSize(block uint64) uint64 {
+	if pow.config.PowMode == ModeTest {
+		return 32 * 1024
+	}
+	return datasetSize(block)
+}
+
+// Threads returns the number of mining threads currently enabled. This doesn't
+// necessarily mean that mining is running!
+func (pow *ProofOfWork) Threads() int {
+	pow.lock.Lock()
+	defer pow.lock.Unlock()
 
-		log.Panic(err)
+	return pow.threads
+}
+
+// SetThreads updates the number of mining threads currently enabled. Calling
+// this method does not start mining, only sets the thread count. If zero is
+// specified, the miner will use all cores of the machine. Running seals are
+// not affected, the new thread count is picked up by the next one.
+func (pow *ProofOfWork) SetThreads(threads int) {
+	pow.lock.Lock()
+	defer pow.lock.Unlock()
+
+	if threads < 0 {
+		threads = 0
 	}
+	pow.threads = threads
+}
 
-	return buff.Bytes()
+// Hashrate returns the measured rate of the search invocations per second over
+// the current sealing run, or the last one if no sealing is in progress.
+func (pow *ProofOfWork) Hashrate() float64 {
+	pow.lock.Lock()
+	start, end := pow.sealStart, pow.sealEnd
+	pow.lock.Unlock()
+
+	if start.IsZero() {
+		return 0
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	elapsed := end.Sub(start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(atomic.LoadUint64(&pow.hashes)) / elapsed
 }
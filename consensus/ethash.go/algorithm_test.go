@@ -0,0 +1,103 @@
+package ethash
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Tests whether the hashimoto lookup works for both light as well as the full
+// datasets, producing the reference ethash values.
+func TestHashimoto(t *testing.T) {
+	// Create the verification cache and mining dataset
+	cache := generateCache(1024, seedHash(1))
+	dataset := generateDataset(32*1024, cache)
+
+	// Create a block to verify
+	hash, _ := hex.DecodeString("c9149cc0386e689d789a1c2f3d5d169a61a6218ed30e74414dc736e442ef3d1f")
+	nonce := uint64(0)
+
+	wantDigest, _ := hex.DecodeString("e4073cffaef931d37117cefd9afd27ea0f1cad6a981dd2605c4a1ac97c519800")
+	wantResult, _ := hex.DecodeString("d3539235ee2e6f8db665c0a72169f55b7f6c605712330b778ec3944f0eb5a557")
+
+	digest, result := hashimotoLight(32*1024, cache, hash, nonce)
+	if !bytes.Equal(digest, wantDigest) {
+		t.Errorf("light hashimoto digest mismatch: have %x, want %x", digest, wantDigest)
+	}
+	if !bytes.Equal(result, wantResult) {
+		t.Errorf("light hashimoto result mismatch: have %x, want %x", result, wantResult)
+	}
+	digest, result = hashimotoFull(dataset, hash, nonce)
+	if !bytes.Equal(digest, wantDigest) {
+		t.Errorf("full hashimoto digest mismatch: have %x, want %x", digest, wantDigest)
+	}
+	if !bytes.Equal(result, wantResult) {
+		t.Errorf("full hashimoto result mismatch: have %x, want %x", result, wantResult)
+	}
+}
+
+// Tests that the light and full hashimoto variants agree on the digest and
+// final PoW value when run over the same tiny test dataset.
+func TestHashimotoLightFull(t *testing.T) {
+	var (
+		seed    = seedHash(0)
+		cache   = generateCache(1024, seed)
+		dataset = generateDataset(32*1024, cache)
+		hash    = bytes.Repeat([]byte{0xc9}, 32)
+	)
+	for nonce := uint64(0); nonce < 16; nonce++ {
+		lightDigest, lightResult := hashimotoLight(32*1024, cache, hash, nonce)
+		fullDigest, fullResult := hashimotoFull(dataset, hash, nonce)
+
+		if !bytes.Equal(lightDigest, fullDigest) {
+			t.Errorf("nonce %d: digest mismatch: light %x, full %x", nonce, lightDigest, fullDigest)
+		}
+		if !bytes.Equal(lightResult, fullResult) {
+			t.Errorf("nonce %d: result mismatch: light %x, full %x", nonce, lightResult, fullResult)
+		}
+	}
+}
+
+// Tests that the seed hash only changes at epoch boundaries.
+func TestSeedHash(t *testing.T) {
+	if seed := seedHash(epochLength - 1); !bytes.Equal(seed, make([]byte, 32)) {
+		t.Errorf("first epoch seed mismatch: have %x, want zero", seed)
+	}
+	if bytes.Equal(seedHash(epochLength), seedHash(epochLength-1)) {
+		t.Errorf("seed not advanced at epoch boundary")
+	}
+	if !bytes.Equal(seedHash(epochLength), seedHash(2*epochLength-1)) {
+		t.Errorf("seed changed within an epoch")
+	}
+}
+
+// Tests that verification caches are stored on disk and loaded back from there
+// instead of being regenerated.
+func TestCacheDiskStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	first := new(cache)
+	first.generate(dir, 1, true)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "cache-*"))
+	if len(files) != 1 {
+		t.Fatalf("cache files mismatch: have %d, want 1", len(files))
+	}
+	// Corrupting the file on disk must show up in a reloaded cache
+	blob, _ := os.ReadFile(files[0])
+	blob[0] ^= 0xff
+	if err := os.WriteFile(files[0], blob, 0644); err != nil {
+		t.Fatalf("failed to modify cache file: %v", err)
+	}
+	second := new(cache)
+	second.generate(dir, 1, true)
+	if reflect.DeepEqual(first.cache, second.cache) {
+		t.Fatalf("cache not loaded from disk")
+	}
+	if second.cache[0] != first.cache[0]^0xff {
+		t.Errorf("loaded cache mismatch: have %x, want %x", second.cache[0], first.cache[0]^0xff)
+	}
+}
@@ -0,0 +1,237 @@
+package ethash
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/rlp"
+	"golang.org/x/crypto/sha3"
+)
+
+// Ethash proof-of-work protocol constants.
+var (
+	BlockReward            = big.NewInt(2e+18)  // Block reward in wei for successfully mining a block
+	MinimumDifficulty      = big.NewInt(131072) // The minimum that the difficulty may ever be
+	DifficultyBoundDivisor = big.NewInt(2048)   // The bound divisor of the difficulty, used in the update calculations
+)
+
+// MaximumExtraDataSize is the maximum size extra data may be after Genesis.
+const MaximumExtraDataSize uint64 = 32
+
+// Various error messages to mark blocks invalid. These should be private to
+// prevent engine specific errors from being referenced in the remainder of the
+// codebase, inherently breaking if the engine is swapped out. Please put common
+// error types into the consensus package.
+var (
+	errInvalidDifficulty = errors.New("non-positive difficulty")
+	errInvalidMixDigest  = errors.New("invalid mix digest")
+	errInvalidPoW        = errors.New("invalid proof-of-work")
+)
+
+// Author implements consensus.Engine, returning the header's coinbase as the
+// proof-of-work verified author of the block.
+func (pow *ProofOfWork) Author(header *types.Header) (common.Address, error) {
+	return header.Coinbase, nil
+}
+
+// VerifyHeader checks whether a header conforms to the consensus rules of the
+// stock Ethereum ethash engine. The generic header fields (timestamp, gas) are
+// left to the chain's block validator.
+func (pow *ProofOfWork) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	parent := chain.GetHeader(header.ParentHash, header.Number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	// Sanity checks passed, do a proper verification
+	return pow.verifyHeader(chain, header, parent, seal)
+}
+
+// VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers
+// in order. The method returns a quit channel to abort the operations and a
+// results channel to retrieve the async verifications.
+func (pow *ProofOfWork) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort, results := make(chan struct{}), make(chan error, len(headers))
+	go func() {
+		for i, header := range headers {
+			select {
+			case <-abort:
+				return
+			default:
+			}
+			var parent *types.Header
+			if i == 0 {
+				parent = chain.GetHeader(header.ParentHash, header.Number-1)
+			} else if headers[i-1].Hash() == header.ParentHash {
+				parent = headers[i-1]
+			}
+			if parent == nil {
+				results <- consensus.ErrUnknownAncestor
+				continue
+			}
+			results <- pow.verifyHeader(chain, header, parent, seals[i])
+		}
+	}()
+	return abort, results
+}
+
+// verifyHeader checks whether a header conforms to the consensus rules of the
+// stock Ethereum ethash engine.
+func (pow *ProofOfWork) verifyHeader(chain consensus.ChainHeaderReader, header, parent *types.Header, seal bool) error {
+	// Ensure that the header's extra-data section is of a reasonable size
+	if uint64(len(header.Extra)) > MaximumExtraDataSize {
+		return fmt.Errorf("extra-data too long: %d > %d", len(header.Extra), MaximumExtraDataSize)
+	}
+	// Verify that the block number is parent's +1
+	if header.Number-parent.Number != 1 {
+		return consensus.ErrInvalidNumber
+	}
+	// Verify the block's difficulty based on its timestamp and parent's difficulty
+	if header.Difficulty == nil || header.Difficulty.Sign() <= 0 {
+		return errInvalidDifficulty
+	}
+	expected := pow.CalcDifficulty(chain, header.Time, parent)
+	if expected.Cmp(header.Difficulty) != 0 {
+		return fmt.Errorf("invalid difficulty: have %v, want %v", header.Difficulty, expected)
+	}
+	// Verify the engine specific seal securing the block
+	if seal {
+		if err := pow.VerifySeal(header); err != nil {
+			return fmt.Errorf("%w: %v", consensus.ErrInvalidSeal, err)
+		}
+	}
+	return nil
+}
+
+// VerifySeal checks whether a block satisfies the PoW difficulty requirements,
+// recomputing the digest from the header's seal hash and nonce using the light
+// verification cache. The digest must match the one carried in the MixDigest
+// field and the final PoW value fall below the target set by the header's
+// difficulty.
+func (pow *ProofOfWork) VerifySeal(header *types.Header) error {
+	// If we're running a fake PoW, accept any seal as valid
+	if pow.config.PowMode == ModeFake {
+		return nil
+	}
+	// Ensure that we have a valid difficulty for the block
+	if header.Difficulty == nil || header.Difficulty.Sign() <= 0 {
+		return errInvalidDifficulty
+	}
+	// Recompute the digest and PoW values from the verification cache, which
+	// is a lot cheaper than keeping the full mining dataset around
+	number := header.Number
+	cache := pow.cache(number)
+	digest, result := hashimotoLight(pow.datasetSize(number), cache.cache, pow.SealHash(header).Bytes(), uint64(header.Nonce))
+
+	if common.BytesToHash(digest) != header.MixDigest {
+		return errInvalidMixDigest
+	}
+	target := new(big.Int).Div(two256, header.Difficulty)
+	if new(big.Int).SetBytes(result).Cmp(target) > 0 {
+		return errInvalidPoW
+	}
+	return nil
+}
+
+// Prepare implements consensus.Engine, initializing the difficulty field of a
+// header to conform to the ethash protocol. The changes are done inline.
+func (pow *ProofOfWork) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	parent := chain.GetHeader(header.ParentHash, header.Number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	header.Difficulty = pow.CalcDifficulty(chain, header.Time, parent)
+	return nil
+}
+
+// Finalize implements consensus.Engine, accumulating the block rewards.
+func (pow *ProofOfWork) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction) {
+	// Accumulate any block rewards
+	state.AddBalance(header.Coinbase, new(big.Int).Set(BlockReward))
+}
+
+// SealHash returns the hash of a block prior to it being sealed.
+func (pow *ProofOfWork) SealHash(header *types.Header) (hash common.Hash) {
+	hasher := sha3.NewLegacyKeccak256()
+
+	enc := []interface{}{
+		header.ParentHash,
+		header.Coinbase,
+		header.Root,
+		header.TxHash,
+		header.ReceiptHash,
+		header.LogsBloom,
+		header.Difficulty,
+		header.GasLimit,
+		header.GasUsed,
+		header.Number,
+		header.Time,
+		header.Extra,
+	}
+	if header.BaseFee != nil {
+		enc = append(enc, header.BaseFee)
+	}
+	rlp.Encode(hasher, enc)
+	hasher.Sum(hash[:0])
+	return hash
+}
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the
+// difficulty that a new block should have when created at time given the
+// parent block's time and difficulty.
+func (pow *ProofOfWork) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return CalcDifficulty(time, parent)
+}
+
+// Some weird constants to avoid constant memory allocs for them.
+var (
+	big1       = big.NewInt(1)
+	big10      = big.NewInt(10)
+	bigMinus99 = big.NewInt(-99)
+)
+
+// CalcDifficulty is the difficulty adjustment algorithm. It returns the
+// difficulty that a new block should have when created at time given the
+// parent block's time and difficulty. The calculation uses the Homestead
+// rules, retargeting every block on the parent's timestamp delta.
+func CalcDifficulty(time uint64, parent *types.Header) *big.Int {
+	// https://github.com/ethereum/EIPs/issues/2
+	// algorithm:
+	// diff = (parent_diff +
+	//         (parent_diff / 2048 * max(1 - (block_timestamp - parent_timestamp) // 10, -99))
+	//        )
+	bigTime := new(big.Int).SetUint64(time)
+	bigParentTime := new(big.Int).SetUint64(parent.Time)
+
+	parentDifficulty := new(big.Int)
+	if parent.Difficulty != nil {
+		parentDifficulty.Set(parent.Difficulty)
+	}
+	// holds intermediate values to make the algo easier to read & audit
+	x := new(big.Int)
+	y := new(big.Int)
+
+	// 1 - (block_timestamp - parent_timestamp) // 10
+	x.Sub(bigTime, bigParentTime)
+	x.Div(x, big10)
+	x.Sub(big1, x)
+
+	// max(1 - (block_timestamp - parent_timestamp) // 10, -99)
+	if x.Cmp(bigMinus99) < 0 {
+		x.Set(bigMinus99)
+	}
+	// (parent_diff + parent_diff // 2048 * max(1 - (block_timestamp - parent_timestamp) // 10, -99))
+	y.Div(parentDifficulty, DifficultyBoundDivisor)
+	x.Mul(y, x)
+	x.Add(parentDifficulty, x)
+
+	// minimum difficulty can ever be (before exponential factor)
+	if x.Cmp(MinimumDifficulty) < 0 {
+		x.Set(MinimumDifficulty)
+	}
+	return x
+}
@@ -0,0 +1,164 @@
+package ethash
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-trie/common"
+)
+
+// testChain is a header reader serving a single parent header.
+type testChain struct {
+	parent *types.Header
+}
+
+func (c *testChain) CurrentHeader() *types.Header { return c.parent }
+
+func (c *testChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if number == c.parent.Number {
+		return c.parent
+	}
+	return nil
+}
+
+func (c *testChain) GetHeaderByNumber(number uint64) *types.Header {
+	return c.GetHeader(common.Hash{}, number)
+}
+
+func (c *testChain) GetHeaderByHash(hash common.Hash) *types.Header { return c.parent }
+
+func TestSealAndVerifyHeader(t *testing.T) {
+	chain := &testChain{parent: &types.Header{Number: 1, Difficulty: big.NewInt(1)}}
+	pow := NewTester()
+
+	header := &types.Header{Number: 2, Time: 10}
+	if err := pow.Prepare(chain, header); err != nil {
+		t.Fatalf("failed to prepare header: %v", err)
+	}
+	results := make(chan *types.Block, 1)
+	if err := pow.Seal(chain, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	sealed := (<-results).Header()
+
+	if err := pow.VerifyHeader(chain, sealed, true); err != nil {
+		t.Fatalf("sealed header rejected: %v", err)
+	}
+	// Tampering with any sealed field must invalidate the seal
+	tampered := types.CopyHeader(sealed)
+	tampered.Nonce++
+	if err := pow.VerifyHeader(chain, tampered, true); err == nil {
+		t.Errorf("tampered nonce accepted")
+	}
+	tampered = types.CopyHeader(sealed)
+	tampered.Time++
+	if err := pow.VerifyHeader(chain, tampered, true); err == nil {
+		t.Errorf("tampered timestamp accepted")
+	}
+	// Unknown parents are reported as such
+	orphan := types.CopyHeader(sealed)
+	orphan.Number = 5
+	if err := pow.VerifyHeader(chain, orphan, true); !errors.Is(err, consensus.ErrUnknownAncestor) {
+		t.Errorf("orphan error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
+
+func TestCalcDifficulty(t *testing.T) {
+	parentDiff := new(big.Int).Mul(MinimumDifficulty, big.NewInt(4))
+	step := new(big.Int).Div(parentDiff, DifficultyBoundDivisor)
+
+	tests := []struct {
+		parent *big.Int
+		time   uint64
+		want   *big.Int
+	}{
+		// Fast blocks raise the difficulty by one step
+		{parentDiff, 105, new(big.Int).Add(parentDiff, step)},
+		// Blocks on target keep the difficulty
+		{parentDiff, 110, parentDiff},
+		// Slow blocks lower it proportionally to the delay
+		{parentDiff, 135, new(big.Int).Sub(parentDiff, new(big.Int).Mul(step, big.NewInt(2)))},
+		// The adjustment of very slow blocks is capped
+		{parentDiff, 100000, new(big.Int).Sub(parentDiff, new(big.Int).Mul(step, big.NewInt(99)))},
+		// The difficulty never drops below the minimum
+		{MinimumDifficulty, 200, MinimumDifficulty},
+		{big.NewInt(1), 105, MinimumDifficulty},
+	}
+	for i, tt := range tests {
+		parent := &types.Header{Time: 100, Difficulty: tt.parent}
+		if have := CalcDifficulty(tt.time, parent); have.Cmp(tt.want) != 0 {
+			t.Errorf("test %d: difficulty mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+func TestSealAbort(t *testing.T) {
+	pow := NewTester()
+	pow.SetThreads(2)
+
+	// An unreachable difficulty keeps the threads busy until stopped
+	header := &types.Header{Number: 1, Difficulty: new(big.Int).Lsh(big.NewInt(1), 255)}
+	results, stop := make(chan *types.Block, 1), make(chan struct{})
+	if err := pow.Seal(nil, types.NewBlockWithHeader(header), results, stop); err != nil {
+		t.Fatalf("failed to start sealing: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); pow.Hashrate() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("no hash rate reported while sealing")
+		}
+	}
+	close(stop)
+
+	select {
+	case block := <-results:
+		t.Fatalf("aborted seal produced block with nonce %d", block.Header().Nonce)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestVerifySeal(t *testing.T) {
+	pow := NewTester()
+
+	header := &types.Header{Number: 1, Difficulty: new(big.Int).Set(MinimumDifficulty)}
+	results := make(chan *types.Block, 1)
+	if err := pow.Seal(nil, types.NewBlockWithHeader(header), results, nil); err != nil {
+		t.Fatalf("failed to seal block: %v", err)
+	}
+	sealed := (<-results).Header()
+	if err := pow.VerifySeal(sealed); err != nil {
+		t.Fatalf("valid seal rejected: %v", err)
+	}
+	// A digest not matching the header is rejected
+	tampered := types.CopyHeader(sealed)
+	tampered.MixDigest[0] ^= 0xff
+	if err := pow.VerifySeal(tampered); err != errInvalidMixDigest {
+		t.Errorf("mix digest error mismatch: have %v, want %v", err, errInvalidMixDigest)
+	}
+	// The seal covers the logs bloom, so a swapped bloom is rejected
+	tampered = types.CopyHeader(sealed)
+	tampered.LogsBloom[0] ^= 0xff
+	if pow.SealHash(tampered) == pow.SealHash(sealed) {
+		t.Errorf("seal hash does not cover the logs bloom")
+	}
+	if err := pow.VerifySeal(tampered); err != errInvalidMixDigest {
+		t.Errorf("swapped bloom error mismatch: have %v, want %v", err, errInvalidMixDigest)
+	}
+	// A correct digest missing the header's target is rejected
+	tampered = types.CopyHeader(sealed)
+	tampered.Difficulty = new(big.Int).Lsh(big.NewInt(1), 250)
+	digest, _ := hashimotoLight(pow.datasetSize(tampered.Number), pow.cache(tampered.Number).cache, pow.SealHash(tampered).Bytes(), uint64(tampered.Nonce))
+	tampered.MixDigest = common.BytesToHash(digest)
+	if err := pow.VerifySeal(tampered); err != errInvalidPoW {
+		t.Errorf("proof-of-work error mismatch: have %v, want %v", err, errInvalidPoW)
+	}
+	// Headers without difficulty can't carry a valid seal
+	tampered = types.CopyHeader(sealed)
+	tampered.Difficulty = new(big.Int)
+	if err := pow.VerifySeal(tampered); err != errInvalidDifficulty {
+		t.Errorf("difficulty error mismatch: have %v, want %v", err, errInvalidDifficulty)
+	}
+}
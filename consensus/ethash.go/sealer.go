@@ -0,0 +1,171 @@
+package ethash
+
+import (
+	crand "crypto/rand"
+	"log"
+	"math"
+	"math/big"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-trie/common"
+)
+
+// Seal implements consensus.Engine, attempting to find a nonce that satisfies
+// the block's difficulty requirements. The search is spread over the enabled
+// mining threads, each one scanning its own slice of the nonce space from a
+// random starting point, and is abandoned once stop is closed.
+func (pow *ProofOfWork) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	// If we're running a fake PoW, simply return a 0 nonce immediately
+	if pow.config.PowMode == ModeFake {
+		header := types.CopyHeader(block.Header())
+		header.Nonce, header.MixDigest = types.BlockNonce(0), common.Hash{}
+		select {
+		case results <- block.WithSeal(header):
+		default:
+			log.Printf("Sealing result is not read by miner, mode fake, sealhash %x", pow.SealHash(block.Header()))
+		}
+		return nil
+	}
+	// Create a runner and the multiple search threads it directs
+	abort := make(chan struct{})
+
+	pow.lock.Lock()
+	threads := pow.threads
+	if pow.rand == nil {
+		seed, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
+		if err != nil {
+			pow.lock.Unlock()
+			return err
+		}
+		pow.rand = rand.New(rand.NewSource(seed.Int64()))
+	}
+	if threads == 0 {
+		threads = runtime.NumCPU()
+	}
+	// Split the nonce space into disjoint ranges, one per thread, and pick a
+	// random starting point within each of them
+	var (
+		span  = math.MaxUint64 / uint64(threads)
+		seeds = make([]uint64, threads)
+	)
+	for i := range seeds {
+		seeds[i] = uint64(i)*span + uint64(pow.rand.Int63())%span
+	}
+	start := time.Now()
+	pow.sealStart, pow.sealEnd = start, time.Time{}
+	atomic.StoreUint64(&pow.hashes, 0)
+	pow.lock.Unlock()
+
+	var (
+		pend   sync.WaitGroup
+		locals = make(chan *types.Block)
+	)
+	for i := 0; i < threads; i++ {
+		pend.Add(1)
+		go func(id int, first uint64) {
+			defer pend.Done()
+			pow.mine(block, id, first, span, seeds[id], abort, locals)
+		}(i, uint64(i)*span)
+	}
+	// Wait until sealing is terminated or a nonce is found
+	go func() {
+		var result *types.Block
+		select {
+		case <-stop:
+			// Outside abort, stop all miner threads
+			close(abort)
+		case result = <-locals:
+			// One of the threads found a block, abort all others
+			select {
+			case results <- result:
+			default:
+				log.Printf("Sealing result is not read by miner, sealhash %x", pow.SealHash(block.Header()))
+			}
+			close(abort)
+		}
+		// Wait for all miners to terminate and close off the hash rate window
+		pend.Wait()
+
+		pow.lock.Lock()
+		if pow.sealStart.Equal(start) {
+			pow.sealEnd = time.Now()
+		}
+		pow.lock.Unlock()
+	}()
+	return nil
+}
+
+// mine is the actual proof-of-work miner that searches for a nonce within the
+// range [first, first+span) starting from seed, that results in correct final
+// block difficulty.
+func (pow *ProofOfWork) mine(block *types.Block, id int, first, span, seed uint64, abort <-chan struct{}, found chan *types.Block) {
+	// Extract some data from the header
+	var (
+		header  = block.Header()
+		hash    = pow.SealHash(header).Bytes()
+		target  = new(big.Int).Div(two256, header.Difficulty)
+		number  = header.Number
+		dataset = pow.dataset(number)
+	)
+	// Start generating random nonces until we abort or find a good one
+	var (
+		attempts  = uint64(0)
+		total     = uint64(0)
+		nonce     = seed
+		powBuffer = new(big.Int)
+	)
+	defer func() {
+		atomic.AddUint64(&pow.hashes, attempts)
+	}()
+search:
+	for {
+		select {
+		case <-abort:
+			// Mining terminated, update stats and abort
+			log.Printf("Ethash nonce search aborted, miner %d, attempts %d", id, total)
+			break search
+
+		default:
+			// We don't have to update hash rate on every nonce, so update after 2^X nonces
+			attempts++
+			total++
+			if (attempts % (1 << 15)) == 0 {
+				atomic.AddUint64(&pow.hashes, attempts)
+				attempts = 0
+			}
+			// Compute the PoW value of this nonce
+			digest, result := hashimotoFull(dataset.dataset, hash, nonce)
+			if powBuffer.SetBytes(result).Cmp(target) <= 0 {
+				// Correct nonce found, create a new header with it
+				header = types.CopyHeader(header)
+				header.Nonce = types.BlockNonce(nonce)
+				header.MixDigest = common.BytesToHash(digest)
+
+				// Seal and return a block (if still needed)
+				select {
+				case found <- block.WithSeal(header):
+					log.Printf("Ethash nonce found and reported, miner %d, attempts %d, nonce %d", id, total, nonce)
+				case <-abort:
+					log.Printf("Ethash nonce found but discarded, miner %d, attempts %d, nonce %d", id, total, nonce)
+				}
+				break search
+			}
+			// Move on to the next nonce, wrapping around within our range
+			if nonce++; nonce == first+span {
+				nonce = first
+			}
+			if nonce == seed {
+				// Nothing left to try, wait for the others to finish
+				log.Printf("Ethash nonce range exhausted, miner %d, attempts %d", id, total)
+				<-abort
+				break search
+			}
+		}
+	}
+}
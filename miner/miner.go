@@ -0,0 +1,78 @@
+// Package miner implements block creation and sealing on top of the local
+// chain head.
+package miner
+
+import (
+	"github.com/universe-30/mt-bc/chain"
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/common"
+)
+
+// blockChain is the part of the chain the miner builds on: the head and its
+// state to execute against, and the import path for sealed blocks.
+type blockChain interface {
+	chain.ChainContext
+	consensus.ChainHeaderReader
+
+	CurrentBlock() *types.Block
+	StateAt(root common.Hash) (*state.StateDB, error)
+	InsertBlock(block *types.Block) error
+
+	SubscribeChainHeadEvent(ch chan<- chain.ChainHeadEvent) func()
+}
+
+// TxSource provides the executable transactions to pack into new blocks,
+// grouped by sender and sorted by nonce. It is implemented by txpool.TxPool.
+type TxSource interface {
+	Pending() map[common.Address]types.Transactions
+}
+
+// Config is the configuration parameters of mining.
+type Config struct {
+	Etherbase common.Address // Public address for block mining rewards
+	GasCeil   uint64         // Target gas ceiling for mined blocks.
+}
+
+// Miner creates blocks and searches for proof-of-work values.
+type Miner struct {
+	worker *worker
+}
+
+// New creates a miner building blocks on top of the given chain with the
+// transactions of txs, executed under the rules chainConfig schedules, and
+// sealing them with engine.
+func New(config *Config, chainConfig *params.ChainConfig, bc blockChain, txs TxSource, engine consensus.Engine) *Miner {
+	return &Miner{
+		worker: newWorker(config, chainConfig, bc, txs, engine),
+	}
+}
+
+// Start begins sealing blocks on top of the current head, crediting rewards
+// to coinbase.
+func (miner *Miner) Start(coinbase common.Address) {
+	miner.SetEtherbase(coinbase)
+	miner.worker.start()
+}
+
+// Stop aborts the sealing work in flight and stops building new blocks.
+func (miner *Miner) Stop() {
+	miner.worker.stop()
+}
+
+// Close terminates the miner and all its background goroutines.
+func (miner *Miner) Close() {
+	miner.worker.close()
+}
+
+// Mining returns whether the miner is currently building blocks.
+func (miner *Miner) Mining() bool {
+	return miner.worker.isRunning()
+}
+
+// SetEtherbase sets the address credited with the rewards of new blocks.
+func (miner *Miner) SetEtherbase(addr common.Address) {
+	miner.worker.setEtherbase(addr)
+}
@@ -0,0 +1,219 @@
+package miner
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/universe-30/mt-bc/chain"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/chain/vm"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-bc/consensus/ethash.go"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/accdb/memorydb"
+	"github.com/universe-30/mt-trie/common"
+	"github.com/universe-30/mt-trie/crypto"
+)
+
+var (
+	testKey, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr   = crypto.PubkeyToAddress(testKey.PublicKey)
+	testSigner = types.LatestSigner(params.TestChainConfig)
+	testBanker = common.Address{0x01}
+)
+
+// testTxSource serves a fixed set of pending transactions.
+type testTxSource struct {
+	pending map[common.Address]types.Transactions
+}
+
+func (s *testTxSource) Pending() map[common.Address]types.Transactions {
+	pending := make(map[common.Address]types.Transactions)
+	for addr, txs := range s.pending {
+		pending[addr] = txs
+	}
+	return pending
+}
+
+// testEngine is a fake proof-of-work engine handing out blocks unchanged once
+// released through the seal channel, and recording the blocks whose sealing
+// got aborted.
+type testEngine struct {
+	*ethash.ProofOfWork
+
+	seal    chan struct{}
+	aborted chan *types.Block
+}
+
+func newTestEngine() *testEngine {
+	return &testEngine{
+		ProofOfWork: ethash.NewFaker(),
+		seal:        make(chan struct{}, 1),
+		aborted:     make(chan *types.Block, 1),
+	}
+}
+
+func (e *testEngine) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	go func() {
+		select {
+		case <-e.seal:
+			results <- block
+		case <-stop:
+			e.aborted <- block
+		}
+	}()
+	return nil
+}
+
+func newTestChain(t *testing.T, engine consensus.Engine) *chain.BlockChain {
+	db := memorydb.New()
+	genesis := &chain.Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  chain.GenesisAlloc{testAddr: {Balance: big.NewInt(1000000000000000000)}},
+	}
+	genesis.MustCommit(db)
+
+	bc, err := chain.NewBlockChain(db, params.TestChainConfig, engine)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	return bc
+}
+
+func TestMinerSealsPendingTransactions(t *testing.T) {
+	engine := newTestEngine()
+	engine.seal <- struct{}{}
+	bc := newTestChain(t, engine)
+	genesis := bc.CurrentBlock()
+
+	tx := types.MustSignNewTx(testKey, testSigner, &types.LegacyTx{
+		GasPrice: new(big.Int).SetUint64(chain.InitialBaseFee),
+		Gas:      21000,
+		To:       &common.Address{},
+	})
+	from, _ := types.Sender(testSigner, tx)
+	txs := &testTxSource{pending: map[common.Address]types.Transactions{from: {tx}}}
+
+	heads := make(chan chain.ChainHeadEvent, 1)
+	defer bc.SubscribeChainHeadEvent(heads)()
+
+	miner := New(&Config{GasCeil: chain.GenesisGasLimit}, params.TestChainConfig, bc, txs, engine)
+	defer miner.Close()
+	miner.Start(testBanker)
+
+	select {
+	case ev := <-heads:
+		block := ev.Block
+		if block.NumberU64() != genesis.NumberU64()+1 {
+			t.Fatalf("block number mismatch: have %d, want %d", block.NumberU64(), genesis.NumberU64()+1)
+		}
+		if block.Header().Coinbase != testBanker {
+			t.Errorf("coinbase mismatch: have %x, want %x", block.Header().Coinbase, testBanker)
+		}
+		if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != tx.Hash() {
+			t.Errorf("pending transaction not included")
+		}
+		if block.GasUsed() != 21000 {
+			t.Errorf("gas used mismatch: have %d, want %d", block.GasUsed(), 21000)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no block sealed")
+	}
+}
+
+func TestMinerAbortsOnNewHead(t *testing.T) {
+	engine := newTestEngine()
+	bc := newTestChain(t, engine)
+	genesis := bc.CurrentBlock()
+
+	miner := New(&Config{GasCeil: chain.GenesisGasLimit}, params.TestChainConfig, bc, &testTxSource{}, engine)
+	defer miner.Close()
+	miner.Start(testBanker)
+	waitForTask(t, miner)
+
+	// Import a competing block, which must abort the sealing on top of genesis
+	statedb, _ := bc.StateAt(genesis.Root())
+	header := &types.Header{
+		ParentHash: genesis.Hash(),
+		Number:     genesis.NumberU64() + 1,
+		GasLimit:   genesis.GasLimit(),
+		Time:       genesis.Time() + 1,
+		BaseFee:    chain.CalcBaseFee(params.TestChainConfig, genesis.Header()),
+	}
+	header.Difficulty = engine.CalcDifficulty(bc, header.Time, genesis.Header())
+	engine.Finalize(bc, header, statedb, nil)
+	header.Root = statedb.IntermediateRoot(true)
+	if err := bc.InsertBlock(types.NewBlock(header, nil, nil)); err != nil {
+		t.Fatalf("failed to insert block: %v", err)
+	}
+	select {
+	case block := <-engine.aborted:
+		if block.ParentHash() != genesis.Hash() {
+			t.Errorf("aborted block parent mismatch: have %x, want %x", block.ParentHash(), genesis.Hash())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("sealing not aborted on new head")
+	}
+}
+
+// waitForTask blocks until the miner has handed its first block to the engine.
+func waitForTask(t *testing.T, miner *Miner) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		miner.worker.taskMu.Lock()
+		current := miner.worker.current
+		miner.worker.taskMu.Unlock()
+
+		if current != nil {
+			return
+		}
+	}
+	t.Fatalf("no mining work committed")
+}
+
+func TestRejectedTransactionKeepsGas(t *testing.T) {
+	bc := newTestChain(t, ethash.NewFaker())
+	genesis := bc.CurrentBlock()
+
+	w := newWorker(&Config{GasCeil: chain.GenesisGasLimit}, params.TestChainConfig, bc, &testTxSource{}, ethash.NewFaker())
+	defer w.close()
+
+	otherKey, _ := crypto.GenerateKey()
+	otherAddr := crypto.PubkeyToAddress(otherKey.PublicKey)
+
+	statedb, _ := bc.StateAt(genesis.Root())
+	statedb.AddBalance(otherAddr, big.NewInt(1000000000000000000))
+
+	// The pricier transaction buys its gas but then fails the intrinsic gas
+	// check, its data costs more than the plain transfer it paid for
+	price := new(big.Int).SetUint64(chain.InitialBaseFee)
+	bad := types.MustSignNewTx(testKey, testSigner, &types.LegacyTx{
+		GasPrice: new(big.Int).Mul(price, big.NewInt(2)),
+		Gas:      vm.TxGas,
+		To:       &common.Address{},
+		Data:     []byte{0x01},
+	})
+	good := types.MustSignNewTx(otherKey, testSigner, &types.LegacyTx{
+		GasPrice: price,
+		Gas:      vm.TxGas,
+		To:       &common.Address{},
+	})
+	pending := map[common.Address]types.Transactions{testAddr: {bad}, otherAddr: {good}}
+
+	// Leave room for one transaction only
+	header := &types.Header{
+		ParentHash: genesis.Hash(),
+		Number:     genesis.NumberU64() + 1,
+		GasLimit:   vm.TxGas + vm.TxGas/2,
+		Time:       genesis.Time() + 1,
+		BaseFee:    chain.CalcBaseFee(params.TestChainConfig, genesis.Header()),
+	}
+	txs := types.NewTransactionsByPriceAndNonce(testSigner, pending, header.BaseFee)
+	included, _ := w.commitTransactions(statedb, header, testBanker, txs)
+	if len(included) != 1 || included[0].Hash() != good.Hash() {
+		t.Fatalf("included transactions mismatch: have %d, want the valid one", len(included))
+	}
+	if header.GasUsed != vm.TxGas {
+		t.Errorf("gas used mismatch: have %d, want %d", header.GasUsed, vm.TxGas)
+	}
+}
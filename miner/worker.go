@@ -0,0 +1,328 @@
+package miner
+
+import (
+	"errors"
+	"log"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/universe-30/mt-bc/chain"
+	"github.com/universe-30/mt-bc/chain/state"
+	"github.com/universe-30/mt-bc/chain/types"
+	"github.com/universe-30/mt-bc/chain/vm"
+	"github.com/universe-30/mt-bc/consensus"
+	"github.com/universe-30/mt-bc/params"
+	"github.com/universe-30/mt-trie/common"
+)
+
+const (
+	// resultQueueSize is the size of channel listening to sealing result.
+	resultQueueSize = 10
+
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
+)
+
+// task contains all information for consensus engine sealing and result submitting.
+type task struct {
+	block     *types.Block
+	createdAt time.Time
+}
+
+// worker is the main object which takes care of assembling new blocks from the
+// pending transactions, handing them to the consensus engine for sealing and
+// inserting the sealed results into the chain.
+type worker struct {
+	config *Config
+	signer types.Signer
+	engine consensus.Engine
+	chain  blockChain
+	txs    TxSource
+
+	chainConfig *params.ChainConfig
+
+	// Channels
+	chainHeadCh chan chain.ChainHeadEvent
+	unsubscribe func()
+	startCh     chan struct{}
+	stopCh      chan struct{}
+	exitCh      chan struct{}
+	resultCh    chan *types.Block
+
+	mu       sync.RWMutex // The lock used to protect the coinbase
+	coinbase common.Address
+
+	taskMu  sync.Mutex // The lock used to protect the task in flight
+	current *task      // The block handed to the engine for sealing
+
+	running int32 // The indicator whether the consensus engine is running or not.
+	wg      sync.WaitGroup
+}
+
+func newWorker(config *Config, chainConfig *params.ChainConfig, bc blockChain, txs TxSource, engine consensus.Engine) *worker {
+	worker := &worker{
+		config:      config,
+		signer:      types.LatestSigner(chainConfig),
+		engine:      engine,
+		chain:       bc,
+		txs:         txs,
+		chainConfig: chainConfig,
+		coinbase:    config.Etherbase,
+		chainHeadCh: make(chan chain.ChainHeadEvent, chainHeadChanSize),
+		startCh:     make(chan struct{}, 1),
+		stopCh:      make(chan struct{}, 1),
+		exitCh:      make(chan struct{}),
+		resultCh:    make(chan *types.Block, resultQueueSize),
+	}
+	// Subscribe events for blockchain
+	worker.unsubscribe = bc.SubscribeChainHeadEvent(worker.chainHeadCh)
+
+	worker.wg.Add(2)
+	go worker.mainLoop()
+	go worker.resultLoop()
+
+	return worker
+}
+
+// setEtherbase sets the etherbase used to initialize the block coinbase field.
+func (w *worker) setEtherbase(addr common.Address) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.coinbase = addr
+}
+
+// etherbase retrieves the configured etherbase address.
+func (w *worker) etherbase() common.Address {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.coinbase
+}
+
+// start sets the running status as 1 and triggers new work submitting.
+func (w *worker) start() {
+	atomic.StoreInt32(&w.running, 1)
+	select {
+	case w.startCh <- struct{}{}:
+	default:
+	}
+}
+
+// stop sets the running status as 0 and aborts the sealing in flight.
+func (w *worker) stop() {
+	atomic.StoreInt32(&w.running, 0)
+	select {
+	case w.stopCh <- struct{}{}:
+	default:
+	}
+}
+
+// isRunning returns an indicator whether worker is running or not.
+func (w *worker) isRunning() bool {
+	return atomic.LoadInt32(&w.running) == 1
+}
+
+// close terminates all background threads maintained by the worker.
+// Note the worker does not support being closed multiple times.
+func (w *worker) close() {
+	atomic.StoreInt32(&w.running, 0)
+	close(w.exitCh)
+	w.wg.Wait()
+}
+
+// mainLoop is a standalone goroutine to regenerate the sealing task whenever
+// mining starts or the chain head moves, aborting the previous sealing attempt.
+func (w *worker) mainLoop() {
+	defer w.wg.Done()
+	defer w.unsubscribe()
+
+	// interrupt aborts the sealing work in flight, if any.
+	var abort chan struct{}
+	interrupt := func() {
+		if abort != nil {
+			close(abort)
+			abort = nil
+		}
+	}
+	defer interrupt()
+
+	commit := func() {
+		interrupt()
+		abort = make(chan struct{})
+		if err := w.commitNewWork(abort); err != nil {
+			log.Printf("Failed to commit new mining work: %v", err)
+		}
+	}
+
+	for {
+		select {
+		case <-w.startCh:
+			commit()
+
+		case <-w.chainHeadCh:
+			// A new head, mined locally or imported, makes the current work stale
+			if w.isRunning() {
+				commit()
+			}
+
+		case <-w.stopCh:
+			interrupt()
+
+		case <-w.exitCh:
+			return
+		}
+	}
+}
+
+// resultLoop is a standalone goroutine to handle sealing result submitting
+// and flush relative data to the database.
+func (w *worker) resultLoop() {
+	defer w.wg.Done()
+
+	for {
+		select {
+		case block := <-w.resultCh:
+			// Short circuit when receiving empty result.
+			if block == nil {
+				continue
+			}
+			w.taskMu.Lock()
+			task := w.current
+			w.taskMu.Unlock()
+
+			// Short circuit when receiving a result for work that was replaced
+			// or that no longer builds on the current head.
+			if task == nil || task.block.ParentHash() != block.ParentHash() {
+				continue
+			}
+			if head := w.chain.CurrentBlock(); head.Hash() != block.ParentHash() {
+				log.Printf("Discarding stale sealed block, number %d", block.NumberU64())
+				continue
+			}
+			if err := w.chain.InsertBlock(block); err != nil {
+				log.Printf("Failed writing block to chain: %v", err)
+				continue
+			}
+			log.Printf("Successfully sealed new block, number %d, hash %x, elapsed %v",
+				block.NumberU64(), block.Hash(), time.Since(task.createdAt))
+
+		case <-w.exitCh:
+			return
+		}
+	}
+}
+
+// commitNewWork assembles a new block on top of the current head, executing
+// as many pending transactions as fit into its gas limit, and hands it to the
+// consensus engine. Closing abort cancels the sealing.
+func (w *worker) commitNewWork(abort chan struct{}) error {
+	tstart := time.Now()
+	parent := w.chain.CurrentBlock()
+
+	timestamp := uint64(tstart.Unix())
+	if parent.Time() >= timestamp {
+		timestamp = parent.Time() + 1
+	}
+	coinbase := w.etherbase()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Coinbase:   coinbase,
+		Number:     parent.NumberU64() + 1,
+		GasLimit:   chain.CalcGasLimit(parent.GasLimit(), w.config.GasCeil),
+		Time:       timestamp,
+	}
+	// Set baseFee and GasLimit if we are on an EIP-1559 chain
+	if w.chainConfig.IsLondon(new(big.Int).SetUint64(header.Number)) {
+		header.BaseFee = chain.CalcBaseFee(w.chainConfig, parent.Header())
+		if !w.chainConfig.IsLondon(new(big.Int).SetUint64(parent.NumberU64())) {
+			parentGasLimit := parent.GasLimit() * chain.ElasticityMultiplier
+			header.GasLimit = chain.CalcGasLimit(parentGasLimit, w.config.GasCeil)
+		}
+	}
+	// Run the consensus preparation with the default or customized consensus engine.
+	if err := w.engine.Prepare(w.chain, header); err != nil {
+		return err
+	}
+	statedb, err := w.chain.StateAt(parent.Root())
+	if err != nil {
+		return err
+	}
+	txs := types.NewTransactionsByPriceAndNonce(w.signer, w.txs.Pending(), header.BaseFee)
+	included, receipts := w.commitTransactions(statedb, header, coinbase, txs)
+
+	// Apply the block rewards before committing to the state root
+	w.engine.Finalize(w.chain, header, statedb, included)
+	header.Root = statedb.IntermediateRoot(w.chainConfig.IsEIP158(new(big.Int).SetUint64(header.Number)))
+	block := types.NewBlock(header, included, receipts)
+
+	w.taskMu.Lock()
+	w.current = &task{block: block, createdAt: tstart}
+	w.taskMu.Unlock()
+
+	log.Printf("Commit new mining work, number %d, txs %d, gas %d", block.NumberU64(), len(included), block.GasUsed())
+	return w.engine.Seal(w.chain, block, w.resultCh, abort)
+}
+
+// commitTransactions applies transactions in price and nonce order until the
+// block gas limit is reached, skipping the ones that can't be executed. The
+// header's GasUsed is updated along the way. Fees are credited to coinbase,
+// which may differ from the header's if the engine repurposes that field.
+func (w *worker) commitTransactions(statedb *state.StateDB, header *types.Header, coinbase common.Address, txs *types.TransactionsByPriceAndNonce) ([]*types.Transaction, []*types.Receipt) {
+	var (
+		included []*types.Transaction
+		receipts []*types.Receipt
+		gasPool  = new(chain.GasPool).AddGas(header.GasLimit)
+	)
+	for {
+		// If we don't have enough gas for any further transactions then we're done
+		if gasPool.Gas() < vm.TxGas {
+			break
+		}
+		// Retrieve the next transaction and abort if all done
+		tx := txs.Peek()
+		if tx == nil {
+			break
+		}
+		// Start executing the transaction. The gas it buys up front is only
+		// returned to the pool if it executes, so restore the pool on failure.
+		statedb.Prepare(tx.Hash(), len(included))
+
+		snap, gasLeft := statedb.Snapshot(), gasPool.Gas()
+		receipt, err := chain.ApplyTransaction(w.chainConfig, w.chain, &coinbase, gasPool, statedb, header, tx, &header.GasUsed)
+		switch {
+		case errors.Is(err, chain.ErrGasLimitReached):
+			// Pop the current out-of-gas transaction without shifting in the next from the account
+			statedb.RevertToSnapshot(snap)
+			gasPool.SetGas(gasLeft)
+			txs.Pop()
+
+		case errors.Is(err, chain.ErrNonceTooHigh):
+			// Reorg notification data race between the transaction pool and miner, skip account
+			statedb.RevertToSnapshot(snap)
+			gasPool.SetGas(gasLeft)
+			txs.Pop()
+
+		case errors.Is(err, chain.ErrNonceTooLow):
+			// New head notification data race between the transaction pool and miner, shift
+			statedb.RevertToSnapshot(snap)
+			gasPool.SetGas(gasLeft)
+			txs.Shift()
+
+		case err == nil:
+			// Everything ok, collect the receipt and shift in the next transaction from the same account
+			included = append(included, tx)
+			receipts = append(receipts, receipt)
+			txs.Shift()
+
+		default:
+			// Strange error, discard the transaction and get the next in line (note, the
+			// nonce-too-high clause will prevent us from executing in vain).
+			log.Printf("Transaction failed, account skipped, hash %x: %v", tx.Hash(), err)
+			statedb.RevertToSnapshot(snap)
+			gasPool.SetGas(gasLeft)
+			txs.Shift()
+		}
+	}
+	return included, receipts
+}
@@ -0,0 +1,163 @@
+// Package params holds the protocol parameters of the chain.
+package params
+
+import (
+	"fmt"
+	"math/big"
+)
+
+var (
+	// MainnetChainConfig is the chain parameters to run a node on the main network.
+	// Its chain ID is distinct from Ethereum's so that transactions signed for
+	// one network cannot be replayed on the other.
+	MainnetChainConfig = &ChainConfig{
+		ChainID:        big.NewInt(3030),
+		HomesteadBlock: big.NewInt(0),
+		EIP155Block:    big.NewInt(0),
+		EIP158Block:    big.NewInt(0),
+		IstanbulBlock:  big.NewInt(0),
+		BerlinBlock:    big.NewInt(0),
+		LondonBlock:    big.NewInt(0),
+	}
+
+	// TestChainConfig contains the chain parameters used by the tests, with
+	// every protocol change enabled from genesis.
+	TestChainConfig = &ChainConfig{
+		ChainID:        big.NewInt(1337),
+		HomesteadBlock: big.NewInt(0),
+		EIP155Block:    big.NewInt(0),
+		EIP158Block:    big.NewInt(0),
+		IstanbulBlock:  big.NewInt(0),
+		BerlinBlock:    big.NewInt(0),
+		LondonBlock:    big.NewInt(0),
+	}
+)
+
+// ChainConfig is the core config which determines the blockchain settings.
+//
+// ChainConfig is stored in the database on a per block basis. This means
+// that any network, identified by its genesis block, can have its own
+// set of configuration options.
+type ChainConfig struct {
+	ChainID *big.Int `json:"chainId"` // chainId identifies the current chain and is used for replay protection
+
+	HomesteadBlock *big.Int `json:"homesteadBlock,omitempty"` // Homestead switch block (nil = no fork, 0 = already homestead)
+	EIP155Block    *big.Int `json:"eip155Block,omitempty"`    // EIP155 HF block
+	EIP158Block    *big.Int `json:"eip158Block,omitempty"`    // EIP158 HF block
+	IstanbulBlock  *big.Int `json:"istanbulBlock,omitempty"`  // Istanbul switch block (nil = no fork, 0 = already on istanbul)
+	BerlinBlock    *big.Int `json:"berlinBlock,omitempty"`    // Berlin switch block (nil = no fork, 0 = already on berlin)
+	LondonBlock    *big.Int `json:"londonBlock,omitempty"`    // London switch block (nil = no fork, 0 = already on london)
+}
+
+// String implements the fmt.Stringer interface.
+func (c *ChainConfig) String() string {
+	return fmt.Sprintf("{ChainID: %v Homestead: %v EIP155: %v EIP158: %v Istanbul: %v Berlin: %v London: %v}",
+		c.ChainID,
+		c.HomesteadBlock,
+		c.EIP155Block,
+		c.EIP158Block,
+		c.IstanbulBlock,
+		c.BerlinBlock,
+		c.LondonBlock,
+	)
+}
+
+// IsHomestead returns whether num is either equal to the homestead block or greater.
+func (c *ChainConfig) IsHomestead(num *big.Int) bool {
+	return isForked(c.HomesteadBlock, num)
+}
+
+// IsEIP155 returns whether num is either equal to the EIP155 fork block or greater.
+func (c *ChainConfig) IsEIP155(num *big.Int) bool {
+	return isForked(c.EIP155Block, num)
+}
+
+// IsEIP158 returns whether num is either equal to the EIP158 fork block or greater.
+func (c *ChainConfig) IsEIP158(num *big.Int) bool {
+	return isForked(c.EIP158Block, num)
+}
+
+// IsIstanbul returns whether num is either equal to the Istanbul fork block or greater.
+func (c *ChainConfig) IsIstanbul(num *big.Int) bool {
+	return isForked(c.IstanbulBlock, num)
+}
+
+// IsBerlin returns whether num is either equal to the Berlin fork block or greater.
+func (c *ChainConfig) IsBerlin(num *big.Int) bool {
+	return isForked(c.BerlinBlock, num)
+}
+
+// IsLondon returns whether num is either equal to the London fork block or greater.
+func (c *ChainConfig) IsLondon(num *big.Int) bool {
+	return isForked(c.LondonBlock, num)
+}
+
+// CheckConfigForkOrder checks that we don't "skip" any forks: a fork may only be
+// scheduled if all the forks before it are, and at an equal or later block.
+func (c *ChainConfig) CheckConfigForkOrder() error {
+	type fork struct {
+		name  string
+		block *big.Int
+	}
+	var lastFork fork
+	for _, cur := range []fork{
+		{name: "homesteadBlock", block: c.HomesteadBlock},
+		{name: "eip155Block", block: c.EIP155Block},
+		{name: "eip158Block", block: c.EIP158Block},
+		{name: "istanbulBlock", block: c.IstanbulBlock},
+		{name: "berlinBlock", block: c.BerlinBlock},
+		{name: "londonBlock", block: c.LondonBlock},
+	} {
+		if lastFork.name != "" {
+			// Next one must be higher number
+			if lastFork.block == nil && cur.block != nil {
+				return fmt.Errorf("unsupported fork ordering: %v not enabled, but %v enabled at %v",
+					lastFork.name, cur.name, cur.block)
+			}
+			if lastFork.block != nil && cur.block != nil {
+				if lastFork.block.Cmp(cur.block) > 0 {
+					return fmt.Errorf("unsupported fork ordering: %v enabled at %v, but %v enabled at %v",
+						lastFork.name, lastFork.block, cur.name, cur.block)
+				}
+			}
+		}
+		lastFork = cur
+	}
+	return nil
+}
+
+// isForked returns whether a fork scheduled at block s is active at the given head block.
+func isForked(s, head *big.Int) bool {
+	if s == nil || head == nil {
+		return false
+	}
+	return s.Cmp(head) <= 0
+}
+
+// Rules wraps ChainConfig and is merely syntactic sugar or can be used for functions
+// that do not have or require information about the block.
+//
+// Rules is a one time interface meaning that it shouldn't be used in between transition
+// phases.
+type Rules struct {
+	ChainID                         *big.Int
+	IsHomestead, IsEIP155, IsEIP158 bool
+	IsIstanbul, IsBerlin, IsLondon  bool
+}
+
+// Rules ensures c's ChainID is not nil.
+func (c *ChainConfig) Rules(num *big.Int) Rules {
+	chainID := c.ChainID
+	if chainID == nil {
+		chainID = new(big.Int)
+	}
+	return Rules{
+		ChainID:     new(big.Int).Set(chainID),
+		IsHomestead: c.IsHomestead(num),
+		IsEIP155:    c.IsEIP155(num),
+		IsEIP158:    c.IsEIP158(num),
+		IsIstanbul:  c.IsIstanbul(num),
+		IsBerlin:    c.IsBerlin(num),
+		IsLondon:    c.IsLondon(num),
+	}
+}